@@ -0,0 +1,9 @@
+package upload
+
+import "io"
+
+// Converter represents a file converter (e.g PNG to JPEG)
+type Converter interface {
+	// Convert writes the content read from r converted to w
+	Convert(w io.Writer, r io.Reader) error
+}
@@ -0,0 +1,51 @@
+package converter
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/h2non/filetype/types"
+	"go.lsl.digital/lardwaz/upload"
+)
+
+// pair is a source and target file type
+type pair struct {
+	from types.Type
+	to   types.Type
+}
+
+// Registered converters
+var (
+	mu         sync.RWMutex
+	converters = make(map[pair]upload.Converter)
+)
+
+// Func is an adapter to use ordinary functions as converters
+type Func func(w io.Writer, r io.Reader) error
+
+// Convert calls f(w, r)
+func (f Func) Convert(w io.Writer, r io.Reader) error {
+	return f(w, r)
+}
+
+// Register sets the converter of files of type from to type to, replacing any existing one
+func Register(from, to types.Type, c upload.Converter) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	converters[pair{from, to}] = c
+}
+
+// Get returns the converter of files of type from to type to
+func Get(from, to types.Type) (upload.Converter, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	c, ok := converters[pair{from, to}]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s to %s", upload.ErrNoConverter, from.Extension, to.Extension)
+	}
+
+	return c, nil
+}
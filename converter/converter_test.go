@@ -0,0 +1,100 @@
+package converter_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/h2non/filetype"
+	"github.com/h2non/filetype/types"
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/converter"
+	utypes "go.lsl.digital/lardwaz/upload/types"
+)
+
+const testDataFolder = "../testdata"
+
+func TestRegister(t *testing.T) {
+	upper := converter.Func(func(w io.Writer, r io.Reader) error {
+		content, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(bytes.ToUpper(content))
+		return err
+	})
+
+	if _, err := converter.Get(utypes.TypePDF, utypes.TypeDOC); !errors.Is(err, upload.ErrNoConverter) {
+		t.Fatalf("Get() error = %v, want %v", err, upload.ErrNoConverter)
+	}
+
+	converter.Register(utypes.TypePDF, utypes.TypeDOC, upper)
+
+	c, err := converter.Get(utypes.TypePDF, utypes.TypeDOC)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := c.Convert(&out, strings.NewReader("pdf")); err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	if out.String() != "PDF" {
+		t.Errorf("Convert() = %s, want %s", out.String(), "PDF")
+	}
+}
+
+func TestImage(t *testing.T) {
+	sources := map[string]types.Type{
+		"normal.png": utypes.TypePNG,
+		"normal.gif": utypes.TypeGIF,
+		"normal.jpg": utypes.TypeJPEG,
+		"normal.bmp": utypes.TypeBMP,
+		"normal.tif": utypes.TypeTIFF,
+	}
+	targets := []types.Type{utypes.TypeJPEG, utypes.TypePNG}
+
+	for name, from := range sources {
+		content, err := ioutil.ReadFile(filepath.Join(testDataFolder, name))
+		if err != nil {
+			t.Fatalf("Cannot open input file %s: %v", name, err)
+		}
+
+		for _, to := range targets {
+			if from == to {
+				continue
+			}
+
+			t.Run(from.Extension+" to "+to.Extension, func(t *testing.T) {
+				c, err := converter.Get(from, to)
+				if err != nil {
+					t.Fatalf("Get() error = %v", err)
+				}
+
+				var out bytes.Buffer
+				if err := c.Convert(&out, bytes.NewReader(content)); err != nil {
+					t.Fatalf("Convert() error = %v", err)
+				}
+
+				if got, _ := filetype.Match(out.Bytes()); got != to {
+					t.Errorf("Convert() type = %v, want %v", got.Extension, to.Extension)
+				}
+			})
+		}
+	}
+}
+
+func TestImageInvalid(t *testing.T) {
+	c, err := converter.Get(utypes.TypePNG, utypes.TypeJPEG)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	if err := c.Convert(ioutil.Discard, strings.NewReader("not an image")); !errors.Is(err, upload.ErrInvalidImage) {
+		t.Errorf("Convert() error = %v, want %v", err, upload.ErrInvalidImage)
+	}
+}
@@ -0,0 +1,74 @@
+package converter
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+
+	"github.com/disintegration/imaging"
+	"github.com/h2non/filetype/types"
+	"go.lsl.digital/lardwaz/upload"
+	utypes "go.lsl.digital/lardwaz/upload/types"
+)
+
+// Image converts images decoded by imaging (JPEG, PNG, GIF, BMP, TIFF) with an encoder
+type Image struct {
+	encode func(io.Writer, image.Image) error
+}
+
+// NewImage returns a new Image writing images with encode
+func NewImage(encode func(io.Writer, image.Image) error) *Image {
+	return &Image{encode: encode}
+}
+
+// Convert decodes the image read from r then writes it encoded to w.
+// Images are written upright as their EXIF orientation is not kept.
+func (c *Image) Convert(w io.Writer, r io.Reader) error {
+	img, err := imaging.Decode(r, imaging.AutoOrientation(true))
+	if err != nil {
+		return fmt.Errorf("%w: %v", upload.ErrInvalidImage, err)
+	}
+
+	return c.encode(w, img)
+}
+
+// EncodeJPEG writes img as JPEG, transparent areas becoming white
+func EncodeJPEG(w io.Writer, img image.Image) error {
+	return imaging.Encode(w, flatten(img), imaging.JPEG)
+}
+
+// EncodePNG writes img as PNG
+func EncodePNG(w io.Writer, img image.Image) error {
+	return imaging.Encode(w, img, imaging.PNG)
+}
+
+// flatten draws img over a white background unless it is opaque
+func flatten(img image.Image) image.Image {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return img
+	}
+
+	bounds := img.Bounds()
+	flat := image.NewRGBA(bounds)
+	draw.Draw(flat, bounds, image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, bounds, img, bounds.Min, draw.Over)
+
+	return flat
+}
+
+func init() {
+	sources := []types.Type{utypes.TypePNG, utypes.TypeGIF, utypes.TypeJPEG, utypes.TypeBMP, utypes.TypeTIFF}
+	targets := map[types.Type]func(io.Writer, image.Image) error{
+		utypes.TypeJPEG: EncodeJPEG,
+		utypes.TypePNG:  EncodePNG,
+	}
+
+	for _, from := range sources {
+		for to, encode := range targets {
+			if from != to {
+				Register(from, to, NewImage(encode))
+			}
+		}
+	}
+}
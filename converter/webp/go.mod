@@ -0,0 +1,20 @@
+module go.lsl.digital/lardwaz/upload/converter/webp
+
+go 1.23
+
+require (
+	github.com/gen2brain/webp v0.5.5
+	github.com/h2non/filetype v1.0.10
+	go.lsl.digital/lardwaz/upload v0.0.0-00010101000000-000000000000
+)
+
+require (
+	github.com/disintegration/imaging v1.5.0 // indirect
+	github.com/ebitengine/purego v0.8.3 // indirect
+	github.com/gosimple/slug v1.4.2 // indirect
+	github.com/rainycape/unidecode v0.0.0-20150907023854-cb7f23ec59be // indirect
+	github.com/tetratelabs/wazero v1.9.0 // indirect
+	golang.org/x/image v0.18.0 // indirect
+)
+
+replace go.lsl.digital/lardwaz/upload => ../..
@@ -0,0 +1,43 @@
+// Package webp writes WebP images, a module of its own so that only users of WebP depend on its encoder.
+// Importing it registers the conversion of images to WebP and the encoder of WebP formats:
+//
+//	import _ "go.lsl.digital/lardwaz/upload/converter/webp"
+package webp
+
+import (
+	"image"
+	"io"
+
+	libwebp "github.com/gen2brain/webp"
+	"github.com/h2non/filetype/types"
+	"go.lsl.digital/lardwaz/upload/converter"
+	"go.lsl.digital/lardwaz/upload/processor/step"
+	utypes "go.lsl.digital/lardwaz/upload/types"
+)
+
+// DefaultQuality is the quality of lossy WebP images unless set
+const DefaultQuality = libwebp.DefaultQuality
+
+// Encode writes img as lossy WebP
+func Encode(w io.Writer, img image.Image) error {
+	return libwebp.Encode(w, img)
+}
+
+// EncodeFormat writes img as WebP with the quality and lossless settings of s
+func EncodeFormat(w io.Writer, img image.Image, s step.Encode) error {
+	quality := DefaultQuality
+	if s.Quality > 0 {
+		quality = s.Quality
+	}
+
+	return libwebp.Encode(w, img, libwebp.Options{Quality: quality, Lossless: s.Lossless})
+}
+
+func init() {
+	sources := []types.Type{utypes.TypePNG, utypes.TypeGIF, utypes.TypeJPEG, utypes.TypeBMP, utypes.TypeTIFF}
+	for _, from := range sources {
+		converter.Register(from, utypes.TypeWEBP, converter.NewImage(Encode))
+	}
+
+	step.RegisterEncoder(utypes.TypeWEBP.Extension, EncodeFormat)
+}
@@ -0,0 +1,173 @@
+package webp_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/h2non/filetype"
+	"github.com/h2non/filetype/types"
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/converter"
+	_ "go.lsl.digital/lardwaz/upload/converter/webp"
+	"go.lsl.digital/lardwaz/upload/file"
+	"go.lsl.digital/lardwaz/upload/option"
+	"go.lsl.digital/lardwaz/upload/processor"
+	"go.lsl.digital/lardwaz/upload/processor/step"
+	"go.lsl.digital/lardwaz/upload/storage"
+	utypes "go.lsl.digital/lardwaz/upload/types"
+	"go.lsl.digital/lardwaz/upload/uploader"
+)
+
+const testDataFolder = "../../testdata"
+
+func TestConvert(t *testing.T) {
+	sources := map[string]types.Type{
+		"normal.png": utypes.TypePNG,
+		"normal.gif": utypes.TypeGIF,
+		"normal.jpg": utypes.TypeJPEG,
+		"normal.bmp": utypes.TypeBMP,
+		"normal.tif": utypes.TypeTIFF,
+	}
+
+	for name, from := range sources {
+		content, err := ioutil.ReadFile(filepath.Join(testDataFolder, name))
+		if err != nil {
+			t.Fatalf("Cannot open input file %s: %v", name, err)
+		}
+
+		t.Run(from.Extension, func(t *testing.T) {
+			c, err := converter.Get(from, utypes.TypeWEBP)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+
+			var out bytes.Buffer
+			if err := c.Convert(&out, bytes.NewReader(content)); err != nil {
+				t.Fatalf("Convert() error = %v", err)
+			}
+
+			if got, _ := filetype.Match(out.Bytes()); got != utypes.TypeWEBP {
+				t.Errorf("Convert() type = %v, want %v", got.Extension, utypes.TypeWEBP.Extension)
+			}
+		})
+	}
+}
+
+func TestUploadConvertTo(t *testing.T) {
+	u := uploader.NewImage(
+		option.Storage(storage.NewMemory()),
+		option.ConvertTo(utypes.TypePNG, utypes.TypeWEBP),
+	)
+
+	content, err := ioutil.ReadFile(filepath.Join(testDataFolder, "transparent.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploaded, err := u.Upload("transparent.png", content)
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	if filepath.Ext(uploaded.DiskPath()) != ".webp" {
+		t.Errorf("Upload() path = %s, want a .webp path", uploaded.DiskPath())
+	}
+
+	// Content is transcoded, not just renamed
+	img, format, err := image.Decode(bytes.NewReader(uploaded.Content()))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if format != "webp" || img.Bounds() != image.Rect(0, 0, 380, 287) {
+		t.Errorf("uploaded %s %v, want webp %v", format, img.Bounds(), image.Rect(0, 0, 380, 287))
+	}
+}
+
+func TestEncode(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 10, 20))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i)
+		if i%4 == 3 {
+			src.Pix[i] = 255
+		}
+	}
+
+	tests := []struct {
+		name      string
+		encode    step.Encode
+		wantChunk string // WebP bitstream, VP8L being lossless
+	}{
+		{"lossy", step.Encode{Extension: "webp"}, "VP8 "},
+		{"lossless", step.Encode{Extension: ".webp", Lossless: true}, "VP8L"},
+		{"quality", step.Encode{Extension: "WEBP", Quality: 10}, "VP8 "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.encode.Check(); err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+
+			frame := &upload.Frame{Image: src}
+			if err := tt.encode.Apply(context.Background(), frame); err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+
+			if got := string(frame.Output.Bytes()[12:16]); got != tt.wantChunk {
+				t.Errorf("WebP chunk = %q, want %q", got, tt.wantChunk)
+			}
+
+			img, format, err := image.Decode(&frame.Output)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if format != "webp" || img.Bounds() != src.Bounds() {
+				t.Errorf("encoded %s %v, want webp %v", format, img.Bounds(), src.Bounds())
+			}
+		})
+	}
+}
+
+func TestOutputType(t *testing.T) {
+	p := processor.NewImage(
+		option.Formats(option.FormatName("thumb"), option.FormatWidth(200), option.FormatHeight(100), option.FormatOutputType(utypes.TypeWEBP)),
+		option.Formats(option.FormatName("lossless"), option.FormatWidth(100), option.FormatOutputType(utypes.TypeWEBP), option.FormatLossless(true)),
+	)
+
+	memStorage := storage.NewMemory()
+	uploadedFile := file.NewMockGeneric("normal.jpg", option.Dir(testDataFolder), option.MediaPrefixURL("/media/"), option.Storage(memStorage))
+
+	job, err := p.Process(uploadedFile, true)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := job.Wait(ctx)
+	if err != nil {
+		t.Fatalf("job failed: %v", err)
+	}
+	if len(result.Formats) != 2 {
+		t.Fatalf("formats = %d, want %d", len(result.Formats), 2)
+	}
+
+	for _, format := range result.Formats {
+		if want := uploadedFile.DiskPath() + "-" + format.Name + ".webp"; format.Path != want {
+			t.Errorf("format path = %s, want %s", format.Path, want)
+		}
+
+		content, _ := memStorage.Bytes(format.Path)
+		config, typ, err := image.DecodeConfig(bytes.NewReader(content))
+		if err != nil {
+			t.Fatalf("DecodeConfig() error = %v", err)
+		}
+		if typ != "webp" || config.Width != format.Width || config.Height != format.Height {
+			t.Errorf("format %s = %s %dx%d, want webp %dx%d", format.Name, typ, config.Width, config.Height, format.Width, format.Height)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package upload
+
+import "errors"
+
+// Errors returned while uploading files
+var (
+	// ErrMaxSize is returned when a file is greater than Options.MaxSize
+	ErrMaxSize = errors.New("file max size error")
+
+	// ErrFileExists is returned when a file already exists at the path of a new file
+	ErrFileExists = errors.New("file already exists")
+
+	// ErrUnknownType is returned when a file type is not part of Options.FileType
+	ErrUnknownType = errors.New("Unknown file type")
+
+	// ErrInvalidImage is returned when a file is not a supported image
+	ErrInvalidImage = errors.New("Not a valid image")
+
+	// ErrImageTooSmall is returned when an image is smaller than OptionsImage.MinWidth or MinHeight
+	ErrImageTooSmall = errors.New("image too small")
+
+	// ErrNoConverter is returned when no converter is registered for an Options.ConvertTo pair
+	ErrNoConverter = errors.New("no converter for file types")
+)
+
+// Errors returned while processing files
+var (
+	// ErrQueueFull is returned when a processing queue rejects a job
+	ErrQueueFull = errors.New("processing queue full")
+
+	// ErrJobDropped is sent on Job.Failed when a job is dropped from a full processing queue
+	ErrJobDropped = errors.New("job dropped from processing queue")
+
+	// ErrProcessorClosed is returned when a closed processor is given a job
+	ErrProcessorClosed = errors.New("processor closed")
+)
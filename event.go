@@ -0,0 +1,63 @@
+package upload
+
+import "time"
+
+// EventType is the kind of an Event
+type EventType int
+
+// Events of the lifecycle of an uploaded file
+const (
+	// EventUploaded is sent once a file is saved by an uploader
+	EventUploaded EventType = iota
+	// EventFormatGenerated is sent once a format of a file is written
+	EventFormatGenerated
+	// EventJobDone is sent once a processing job succeeded
+	EventJobDone
+	// EventJobFailed is sent once a processing job failed, Err being set
+	EventJobFailed
+	// EventDeleted is sent once a file is deleted
+	EventDeleted
+)
+
+// String returns the name of t
+func (t EventType) String() string {
+	switch t {
+	case EventUploaded:
+		return "uploaded"
+	case EventFormatGenerated:
+		return "format_generated"
+	case EventJobDone:
+		return "job_done"
+	case EventJobFailed:
+		return "job_failed"
+	case EventDeleted:
+		return "deleted"
+	default:
+		return "unknown"
+	}
+}
+
+// Event represents a step of the lifecycle of an uploaded file
+type Event struct {
+	Type EventType
+	File Uploaded
+	// Job is set for job events and EventFormatGenerated
+	Job Job
+	// Format is set for EventFormatGenerated
+	Format FormatResult
+	// Err is set for EventJobFailed
+	Err  error
+	Time time.Time
+}
+
+// Events represents subscriptions to the events emitted by uploaders and processors
+type Events interface {
+	OnUploaded(fn func(Event))
+	OnFormatGenerated(fn func(Event))
+	OnJobDone(fn func(Event))
+	OnJobFailed(fn func(Event))
+	OnDeleted(fn func(Event))
+
+	// Emit sends e to the functions subscribed to its type
+	Emit(e Event)
+}
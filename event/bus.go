@@ -0,0 +1,128 @@
+package event
+
+import (
+	"sync"
+	"time"
+
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/option"
+)
+
+// Bus is an implementation of upload.Events.
+// With option.DispatchSync, subscribed functions run on the emitting goroutine, possibly concurrently.
+// With option.DispatchAsync, events are handled in order by a single goroutine, without blocking Emit.
+type Bus struct {
+	dispatch int
+
+	mu       sync.Mutex
+	handlers map[upload.EventType][]func(upload.Event)
+
+	// pending events waiting for the dispatching goroutine, running when dispatching
+	pending []upload.Event
+	running bool
+	idle    *sync.Cond
+}
+
+// NewBus returns a new Bus dispatching events as dispatch (option.DispatchSync or option.DispatchAsync)
+func NewBus(dispatch int) *Bus {
+	b := &Bus{
+		dispatch: dispatch,
+		handlers: make(map[upload.EventType][]func(upload.Event)),
+	}
+	b.idle = sync.NewCond(&b.mu)
+
+	return b
+}
+
+// OnUploaded subscribes fn to upload.EventUploaded
+func (b *Bus) OnUploaded(fn func(upload.Event)) {
+	b.on(upload.EventUploaded, fn)
+}
+
+// OnFormatGenerated subscribes fn to upload.EventFormatGenerated
+func (b *Bus) OnFormatGenerated(fn func(upload.Event)) {
+	b.on(upload.EventFormatGenerated, fn)
+}
+
+// OnJobDone subscribes fn to upload.EventJobDone
+func (b *Bus) OnJobDone(fn func(upload.Event)) {
+	b.on(upload.EventJobDone, fn)
+}
+
+// OnJobFailed subscribes fn to upload.EventJobFailed
+func (b *Bus) OnJobFailed(fn func(upload.Event)) {
+	b.on(upload.EventJobFailed, fn)
+}
+
+// OnDeleted subscribes fn to upload.EventDeleted
+func (b *Bus) OnDeleted(fn func(upload.Event)) {
+	b.on(upload.EventDeleted, fn)
+}
+
+// on subscribes fn to events of type t
+func (b *Bus) on(t upload.EventType, fn func(upload.Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers[t] = append(b.handlers[t], fn)
+}
+
+// Emit sends e to the functions subscribed to its type, setting its Time if zero
+func (b *Bus) Emit(e upload.Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	if b.dispatch != option.DispatchAsync {
+		b.handle(e)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.pending = append(b.pending, e)
+	if !b.running {
+		b.running = true
+		go b.run()
+	}
+}
+
+// Wait waits until events emitted asynchronously are handled
+func (b *Bus) Wait() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for b.running {
+		b.idle.Wait()
+	}
+}
+
+// run handles pending events until none is left
+func (b *Bus) run() {
+	b.mu.Lock()
+	for len(b.pending) > 0 {
+		e := b.pending[0]
+		b.pending = b.pending[1:]
+
+		b.mu.Unlock()
+		b.handle(e)
+		b.mu.Lock()
+	}
+	b.pending = nil
+	b.running = false
+	b.mu.Unlock()
+
+	b.idle.Broadcast()
+}
+
+// handle calls the functions subscribed to the type of e
+func (b *Bus) handle(e upload.Event) {
+	b.mu.Lock()
+	handlers := b.handlers[e.Type]
+	b.mu.Unlock()
+
+	for _, fn := range handlers {
+		fn(e)
+	}
+}
@@ -0,0 +1,108 @@
+package event_test
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/event"
+	"go.lsl.digital/lardwaz/upload/option"
+)
+
+func TestBus(t *testing.T) {
+	tests := []struct {
+		name     string
+		dispatch int
+	}{
+		{"sync", option.DispatchSync},
+		{"async", option.DispatchAsync},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := event.NewBus(tt.dispatch)
+
+			var (
+				mu  sync.Mutex
+				got []upload.EventType
+			)
+			record := func(e upload.Event) {
+				if e.Time.IsZero() {
+					t.Errorf("event %v without time", e.Type)
+				}
+				mu.Lock()
+				got = append(got, e.Type)
+				mu.Unlock()
+			}
+
+			bus.OnUploaded(record)
+			bus.OnFormatGenerated(record)
+			bus.OnJobDone(record)
+			bus.OnJobFailed(record)
+			bus.OnDeleted(record)
+
+			// A second subscriber of the same type
+			var failures []error
+			bus.OnJobFailed(func(e upload.Event) {
+				failures = append(failures, e.Err)
+			})
+
+			failure := errors.New("failure")
+			want := []upload.EventType{
+				upload.EventUploaded,
+				upload.EventFormatGenerated,
+				upload.EventFormatGenerated,
+				upload.EventJobDone,
+				upload.EventJobFailed,
+				upload.EventDeleted,
+			}
+			for _, e := range want {
+				var err error
+				if e == upload.EventJobFailed {
+					err = failure
+				}
+				bus.Emit(upload.Event{Type: e, Err: err})
+			}
+			bus.Wait()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("events = %v, want %v", got, want)
+			}
+			if !reflect.DeepEqual(failures, []error{failure}) {
+				t.Errorf("failures = %v, want %v", failures, []error{failure})
+			}
+		})
+	}
+}
+
+func TestBusAsync(t *testing.T) {
+	bus := event.NewBus(option.DispatchAsync)
+
+	release := make(chan struct{})
+	handled := make(chan struct{})
+	bus.OnUploaded(func(e upload.Event) {
+		<-release
+		close(handled)
+	})
+
+	// Emit does not wait for subscribers
+	bus.Emit(upload.Event{Type: upload.EventUploaded})
+
+	select {
+	case <-handled:
+		t.Fatal("event handled before release")
+	default:
+	}
+
+	close(release)
+	bus.Wait()
+
+	select {
+	case <-handled:
+	default:
+		t.Error("event not handled after Wait")
+	}
+}
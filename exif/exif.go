@@ -0,0 +1,243 @@
+// Package exif reads the EXIF metadata of JPEG, PNG and WebP images
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// Errors returned when reading EXIF metadata
+var (
+	ErrNotFound  = errors.New("exif: no EXIF metadata")
+	ErrMalformed = errors.New("exif: malformed metadata")
+)
+
+// IFD identifies a directory of EXIF tags
+type IFD int
+
+// Directories of EXIF tags
+const (
+	// IFD0 describes the image
+	IFD0 IFD = iota
+	// IFDExif describes the capture
+	IFDExif
+	// IFDGPS describes the location
+	IFDGPS
+)
+
+// Tags of IFD0
+const (
+	TagMake        = 0x010f
+	TagModel       = 0x0110
+	TagOrientation = 0x0112
+	TagDateTime    = 0x0132
+	tagExifIFD     = 0x8769
+	tagGPSIFD      = 0x8825
+)
+
+// Tags of IFDExif
+const (
+	TagExposureTime        = 0x829a
+	TagFNumber             = 0x829d
+	TagISO                 = 0x8827
+	TagDateTimeOriginal    = 0x9003
+	TagDateTimeDigitized   = 0x9004
+	TagOffsetTime          = 0x9010
+	TagOffsetTimeOriginal  = 0x9011
+	TagOffsetTimeDigitized = 0x9012
+	TagFocalLength         = 0x920a
+	TagBodySerialNumber    = 0xa431
+	TagLensModel           = 0xa434
+)
+
+// Tags of IFDGPS
+const (
+	TagGPSLatitudeRef  = 0x0001
+	TagGPSLatitude     = 0x0002
+	TagGPSLongitudeRef = 0x0003
+	TagGPSLongitude    = 0x0004
+	TagGPSAltitudeRef  = 0x0005
+	TagGPSAltitude     = 0x0006
+)
+
+// exifHeader prefixes the TIFF structure in JPEG APP1 segments (and some WebP EXIF chunks)
+var exifHeader = []byte("Exif\x00\x00")
+
+// Raw returns the TIFF structure holding the EXIF metadata of a JPEG, PNG or WebP image
+func Raw(content []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(content, []byte{0xff, 0xd8}):
+		return jpegExif(content)
+	case bytes.HasPrefix(content, pngSignature):
+		return pngExif(content)
+	case len(content) >= 12 && string(content[:4]) == "RIFF" && string(content[8:12]) == "WEBP":
+		return webpExif(content)
+	default:
+		return nil, ErrNotFound
+	}
+}
+
+// Exif holds the tags of the IFD0, Exif and GPS directories of an image
+type Exif struct {
+	tiff *tiff
+	ifds [3]map[uint16]entry
+}
+
+// Decode returns the EXIF metadata of a JPEG, PNG or WebP image
+func Decode(content []byte) (*Exif, error) {
+	raw, err := Raw(content)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := newTIFF(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	ifd0, err := t.ifd(t.first)
+	if err != nil {
+		return nil, err
+	}
+
+	x := &Exif{tiff: t}
+	x.ifds[IFD0] = ifd0
+
+	// Sub-directories are skipped when malformed
+	for ifd, tag := range map[IFD]uint16{IFDExif: tagExifIFD, IFDGPS: tagGPSIFD} {
+		if offset, ok := x.Uint(IFD0, tag); ok {
+			if entries, err := t.ifd(offset); err == nil {
+				x.ifds[ifd] = entries
+			}
+		}
+	}
+	return x, nil
+}
+
+// Uint returns the first value of an unsigned integer tag
+func (x *Exif) Uint(ifd IFD, tag uint16) (uint32, bool) {
+	e, ok := x.ifds[ifd][tag]
+	if !ok {
+		return 0, false
+	}
+	return x.tiff.uint(e)
+}
+
+// String returns the value of an ASCII tag, trimmed of spaces and NULs
+func (x *Exif) String(ifd IFD, tag uint16) (string, bool) {
+	e, ok := x.ifds[ifd][tag]
+	if !ok || e.typ != typeASCII {
+		return "", false
+	}
+
+	s := strings.TrimRight(string(e.value), "\x00 ")
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return s, s != ""
+}
+
+// Rationals returns the values of an unsigned rational tag
+func (x *Exif) Rationals(ifd IFD, tag uint16) ([]float64, bool) {
+	e, ok := x.ifds[ifd][tag]
+	if !ok || e.typ != typeRational || e.count < 1 {
+		return nil, false
+	}
+
+	values := make([]float64, e.count)
+	for i := range values {
+		num, den := x.tiff.order.Uint32(e.value[i*8:]), x.tiff.order.Uint32(e.value[i*8+4:])
+		if den == 0 {
+			return nil, false
+		}
+		values[i] = float64(num) / float64(den)
+	}
+	return values, true
+}
+
+// Orientation returns the EXIF orientation (1-8) of an image, 1 if unknown
+func Orientation(content []byte) int {
+	x, err := Decode(content)
+	if err != nil {
+		return 1
+	}
+
+	if v, ok := x.Uint(IFD0, TagOrientation); ok && v >= 1 && v <= 8 {
+		return int(v)
+	}
+	return 1
+}
+
+// jpegExif returns the payload of the Exif APP1 segment of a JPEG
+func jpegExif(content []byte) ([]byte, error) {
+	for i := 2; i+4 <= len(content); {
+		if content[i] != 0xff {
+			return nil, ErrMalformed
+		}
+		marker := content[i+1]
+		switch {
+		case marker == 0xff:
+			// Fill byte
+			i++
+			continue
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7):
+			// Standalone markers
+			i += 2
+			continue
+		case marker == 0xda || marker == 0xd9:
+			// Metadata precedes the image data
+			return nil, ErrNotFound
+		}
+
+		end := i + 2 + int(binary.BigEndian.Uint16(content[i+2:]))
+		if end > len(content) || end < i+4 {
+			return nil, ErrMalformed
+		}
+		if data := content[i+4 : end]; marker == 0xe1 && bytes.HasPrefix(data, exifHeader) {
+			return data[len(exifHeader):], nil
+		}
+		i = end
+	}
+	return nil, ErrNotFound
+}
+
+// pngSignature starts every PNG
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngExif returns the data of the eXIf chunk of a PNG
+func pngExif(content []byte) ([]byte, error) {
+	for i := len(pngSignature); i+8 <= len(content); {
+		length := int(binary.BigEndian.Uint32(content[i:]))
+		kind := string(content[i+4 : i+8])
+		end := i + 8 + length
+		if length < 0 || end+4 > len(content) {
+			return nil, ErrMalformed
+		}
+		switch kind {
+		case "eXIf":
+			return content[i+8 : end], nil
+		case "IEND":
+			return nil, ErrNotFound
+		}
+		i = end + 4
+	}
+	return nil, ErrNotFound
+}
+
+// webpExif returns the data of the EXIF chunk of a WebP
+func webpExif(content []byte) ([]byte, error) {
+	for i := 12; i+8 <= len(content); {
+		size := int(binary.LittleEndian.Uint32(content[i+4:]))
+		end := i + 8 + size
+		if size < 0 || end > len(content) {
+			return nil, ErrMalformed
+		}
+		if string(content[i:i+4]) == "EXIF" {
+			return bytes.TrimPrefix(content[i+8:end], exifHeader), nil
+		}
+		i = end + size%2
+	}
+	return nil, ErrNotFound
+}
@@ -0,0 +1,152 @@
+package exif_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"go.lsl.digital/lardwaz/upload/exif"
+)
+
+const testDataFolder = "../testdata"
+
+func TestOrientationJPEG(t *testing.T) {
+	for want := 1; want <= 8; want++ {
+		name := fmt.Sprintf("orientation_%d.jpg", want)
+		t.Run(name, func(t *testing.T) {
+			content, err := ioutil.ReadFile(filepath.Join(testDataFolder, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := exif.Orientation(content); got != want {
+				t.Errorf("Orientation() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestOrientation(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		want    int
+	}{
+		{"png", pngWith(tiffOrientation(binary.BigEndian, 6)), 6},
+		{"png_little_endian", pngWith(tiffOrientation(binary.LittleEndian, 8)), 8},
+		{"webp", webpWith(tiffOrientation(binary.BigEndian, 3)), 3},
+		{"webp_exif_header", webpWith(append([]byte("Exif\x00\x00"), tiffOrientation(binary.LittleEndian, 5)...)), 5},
+		{"out_of_range", pngWith(tiffOrientation(binary.BigEndian, 9)), 1},
+		{"no_exif", pngWith(nil), 1},
+		{"truncated_tiff", pngWith(tiffOrientation(binary.BigEndian, 6)[:12]), 1},
+		{"not_an_image", []byte("orientation"), 1},
+		{"empty", nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exif.Orientation(tt.content); got != tt.want {
+				t.Errorf("Orientation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRaw(t *testing.T) {
+	normal, err := ioutil.ReadFile(filepath.Join(testDataFolder, "normal.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		content []byte
+		wantErr error
+	}{
+		{"jpeg", jpegWith(tiffOrientation(binary.BigEndian, 2)), nil},
+		{"png", pngWith(tiffOrientation(binary.BigEndian, 2)), nil},
+		{"webp", webpWith(tiffOrientation(binary.BigEndian, 2)), nil},
+		{"no_exif", normal, exif.ErrNotFound},
+		{"truncated_jpeg", jpegWith(tiffOrientation(binary.BigEndian, 2))[:10], exif.ErrMalformed},
+		{"truncated_png", pngWith(tiffOrientation(binary.BigEndian, 2))[:20], exif.ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := exif.Raw(tt.content)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Raw() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !bytes.Equal(raw, tiffOrientation(binary.BigEndian, 2)) {
+				t.Errorf("Raw() = %x", raw)
+			}
+		})
+	}
+}
+
+// tiffOrientation returns a TIFF structure whose IFD0 only holds an orientation
+func tiffOrientation(order binary.ByteOrder, orientation uint16) []byte {
+	b := make([]byte, 26)
+	if order == binary.LittleEndian {
+		copy(b, "II")
+	} else {
+		copy(b, "MM")
+	}
+	order.PutUint16(b[2:], 42)
+	order.PutUint32(b[4:], 8)
+	order.PutUint16(b[8:], 1)
+	order.PutUint16(b[10:], exif.TagOrientation)
+	order.PutUint16(b[12:], 3)
+	order.PutUint32(b[14:], 1)
+	order.PutUint16(b[18:], orientation)
+	return b
+}
+
+// jpegWith returns the markers of a JPEG with an Exif APP1 segment holding tiff
+func jpegWith(tiff []byte) []byte {
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	b := []byte{0xff, 0xd8, 0xff, 0xe1, byte((len(app1) + 2) >> 8), byte(len(app1) + 2)}
+	b = append(b, app1...)
+	return append(b, 0xff, 0xda, 0, 2, 0xff, 0xd9)
+}
+
+// pngWith returns the chunks of a PNG with an eXIf chunk holding tiff, if not nil
+func pngWith(tiff []byte) []byte {
+	b := []byte("\x89PNG\r\n\x1a\n")
+	chunk := func(kind string, data []byte) {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+		b = append(b, kind...)
+		b = append(b, data...)
+		b = binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(append([]byte(kind), data...)))
+	}
+	chunk("IHDR", make([]byte, 13))
+	if tiff != nil {
+		chunk("eXIf", tiff)
+	}
+	chunk("IEND", nil)
+	return b
+}
+
+// webpWith returns the chunks of a WebP with an EXIF chunk holding data
+func webpWith(data []byte) []byte {
+	var chunks []byte
+	chunk := func(kind string, data []byte) {
+		chunks = append(chunks, kind...)
+		chunks = binary.LittleEndian.AppendUint32(chunks, uint32(len(data)))
+		chunks = append(chunks, data...)
+		if len(data)%2 == 1 {
+			chunks = append(chunks, 0)
+		}
+	}
+	chunk("VP8X", make([]byte, 10))
+	chunk("ICCP", []byte{1, 2, 3})
+	chunk("EXIF", data)
+
+	b := []byte("RIFF")
+	b = binary.LittleEndian.AppendUint32(b, uint32(4+len(chunks)))
+	b = append(b, "WEBP"...)
+	return append(b, chunks...)
+}
@@ -0,0 +1,121 @@
+package exif
+
+import (
+	"encoding/binary"
+)
+
+// Types of IFD entries
+const (
+	typeByte     = 1
+	typeASCII    = 2
+	typeShort    = 3
+	typeLong     = 4
+	typeRational = 5
+)
+
+// typeSizes are the sizes in bytes of the values of each type
+var typeSizes = map[uint16]int{
+	typeByte:     1,
+	typeASCII:    1,
+	typeShort:    2,
+	typeLong:     4,
+	typeRational: 8,
+	7:            1, // UNDEFINED
+	9:            4, // SLONG
+	10:           8, // SRATIONAL
+}
+
+// tiff reads the IFDs of a TIFF structure
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+	first uint32 // Offset of IFD0
+}
+
+// entry is an IFD entry whose value is resolved to its bytes
+type entry struct {
+	typ   uint16
+	count int
+	value []byte
+}
+
+// newTIFF returns a reader of the TIFF structure data
+func newTIFF(data []byte) (*tiff, error) {
+	if len(data) < 8 {
+		return nil, ErrMalformed
+	}
+
+	t := &tiff{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, ErrMalformed
+	}
+	if t.order.Uint16(data[2:]) != 42 {
+		return nil, ErrMalformed
+	}
+
+	t.first = t.order.Uint32(data[4:])
+	return t, nil
+}
+
+// ifd returns the entries of the IFD at offset by tag, skipping the ones of unknown types or out of bounds
+func (t *tiff) ifd(offset uint32) (map[uint16]entry, error) {
+	if int64(offset)+2 > int64(len(t.data)) {
+		return nil, ErrMalformed
+	}
+
+	n := int(t.order.Uint16(t.data[offset:]))
+	start := int(offset) + 2
+	if start+n*12 > len(t.data) {
+		return nil, ErrMalformed
+	}
+
+	entries := make(map[uint16]entry, n)
+	for i := 0; i < n; i++ {
+		raw := t.data[start+i*12 : start+(i+1)*12]
+		tag, typ, count := t.order.Uint16(raw), t.order.Uint16(raw[2:]), t.order.Uint32(raw[4:])
+
+		size, ok := typeSizes[typ]
+		if !ok || int64(count)*int64(size) > int64(len(t.data)) {
+			continue
+		}
+		length := int(count) * size
+
+		// Values of up to 4 bytes are stored in the entry itself
+		value := raw[8:12]
+		if length <= 4 {
+			value = value[:length]
+		} else {
+			at := int64(t.order.Uint32(raw[8:]))
+			if at+int64(length) > int64(len(t.data)) {
+				continue
+			}
+			value = t.data[at : at+int64(length)]
+		}
+
+		entries[tag] = entry{typ: typ, count: int(count), value: value}
+	}
+	return entries, nil
+}
+
+// uint returns the first value of an unsigned BYTE, SHORT or LONG entry
+func (t *tiff) uint(e entry) (uint32, bool) {
+	if e.count < 1 {
+		return 0, false
+	}
+
+	switch e.typ {
+	case typeByte:
+		return uint32(e.value[0]), true
+	case typeShort:
+		return uint32(t.order.Uint16(e.value)), true
+	case typeLong:
+		return t.order.Uint32(e.value), true
+	default:
+		return 0, false
+	}
+}
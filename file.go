@@ -8,4 +8,5 @@ type Uploaded interface {
 	Save([]byte, bool) error
 	Delete() error
 	ChangeExt(string) error
+	Storage() Storage
 }
@@ -0,0 +1,30 @@
+package file
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"path"
+	"strings"
+)
+
+const (
+	// maxCollisionAttempts is the number of names tried before giving up on a collision
+	maxCollisionAttempts = 10
+
+	// collisionTokenLength is the number of random bytes added to the name of a colliding file
+	collisionTokenLength = 3
+)
+
+// addSuffix adds "-token" to p before its extension
+func addSuffix(p, token string) string {
+	ext := path.Ext(p)
+	return strings.TrimSuffix(p, ext) + "-" + token + ext
+}
+
+// randomHex returns n random bytes hex encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
@@ -1,10 +1,13 @@
 package file
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
-	"os"
 	"path"
 	"path/filepath"
 	"strings"
@@ -17,25 +20,53 @@ import (
 
 // Generic implements File interface
 type Generic struct {
-	url      string
-	diskPath string
-	content  []byte
-	options  upload.Options
+	url       string
+	diskPath  string
+	name      string
+	template  string
+	createdAt time.Time
+	content   []byte
+	duplicate bool
+	removed   []upload.MetadataSegment
+	metadata  *upload.Metadata
+	options   upload.Options
 }
 
-// NewGeneric returns a new Generic struct
+// NewGeneric returns a new Generic struct named after Options.PathTemplate
 func NewGeneric(name string, opts upload.Options) *Generic {
-	dirPath := path.Join(opts.Dir(), opts.Destination())
-	name = AddTimestamp(name)
-	urlPath := path.Join(opts.MediaPrefixURL(), opts.Destination(), name)
-	currentTime := time.Now()
-	diskPath := filepath.Join(dirPath, fmt.Sprintf("%d", currentTime.Year()), fmt.Sprintf("%v", currentTime.Month()), name)
+	u := &Generic{
+		name:      name,
+		template:  opts.PathTemplate(),
+		createdAt: time.Now(),
+		options:   opts,
+	}
+
+	if opts.ContentAddressed() {
+		u.template = contentTemplate(opts.ShardDepth())
+	}
+
+	// Files named after their content are named once it is known
+	if hasHash(u.template) {
+		u.setPaths(filepath.Join(opts.Dir(), opts.Destination(), path.Base(name)), "")
+		return u
+	}
 
-	return &Generic{
-		url:      urlPath,
-		diskPath: diskPath,
-		options:  opts,
+	u.render("")
+
+	return u
+}
+
+// NewExisting returns a Generic for a file already stored at diskPath and served at urlPath
+func NewExisting(diskPath, urlPath string, opts upload.Options) *Generic {
+	u := &Generic{
+		name:      path.Base(diskPath),
+		template:  opts.PathTemplate(),
+		createdAt: time.Now(),
+		options:   opts,
 	}
+	u.diskPath, u.url = diskPath, urlPath
+
+	return u
 }
 
 // URLPath returns the url path of file
@@ -48,12 +79,34 @@ func (u *Generic) DiskPath() string {
 	return u.diskPath
 }
 
-// Content returns the path of file on disk
+// Content returns the content of file, lazily read from storage when it was streamed
 func (u *Generic) Content() []byte {
+	if u.content != nil {
+		return u.content
+	}
+
+	r, err := u.Open()
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		log.Printf("error reading %v: %v\n", u.DiskPath(), err)
+		return nil
+	}
+	u.content = content
+
 	return u.content
 }
 
-// Save saves file on disk if it does not exist
+// Open opens the file in storage for reading
+func (u *Generic) Open() (io.ReadCloser, error) {
+	return u.Storage().Get(u.DiskPath())
+}
+
+// Save saves file in storage if it does not exist
 func (u *Generic) Save(content []byte, overwrite bool) error {
 	if !overwrite {
 		return nil
@@ -63,18 +116,25 @@ func (u *Generic) Save(content []byte, overwrite bool) error {
 	size := len(content)
 	if u.options.MaxSize() != option.NoLimit && size > u.options.MaxSize() {
 		log.Printf("file %v greater than max file size: %v\n", u.diskPath, u.options.MaxSize())
-		return fmt.Errorf("file max size error")
+		return upload.ErrMaxSize
 	}
 
-	// Creates full directory structure to store image
-	dir := path.Dir(u.diskPath)
-	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
-		log.Printf("error creating directories %v : %v\n", dir, err)
-		return err
+	if hasHash(u.template) {
+		sum := sha256.Sum256(content)
+		u.render(hex.EncodeToString(sum[:]))
+
+		// Same content, same file: nothing to write
+		if u.exists(u.DiskPath()) {
+			u.duplicate = true
+			u.content = content
+			return nil
+		}
 	}
 
-	if err := ioutil.WriteFile(u.DiskPath(), content, os.FileMode(0644)); err != nil {
-		log.Printf("error writing %v: %v\n", u.DiskPath(), err)
+	err := u.store(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(content)), nil
+	})
+	if err != nil {
 		return err
 	}
 
@@ -83,15 +143,80 @@ func (u *Generic) Save(content []byte, overwrite bool) error {
 	return nil
 }
 
-// Delete deletes one file on disk
+// SaveReader saves content read from r in storage without holding it in memory.
+// Content is written to a temporary file first then moved into place.
+func (u *Generic) SaveReader(r io.Reader, overwrite bool) error {
+	if !overwrite {
+		return nil
+	}
+
+	tmpPath := tempPath(u.diskPath)
+
+	hash := sha256.New()
+	if hasHash(u.template) {
+		r = io.TeeReader(r, hash)
+	}
+
+	// Verify size while copying
+	if err := u.Storage().Put(tmpPath, NewMaxSizeReader(r, u.options.MaxSize())); err != nil {
+		u.Storage().Delete(tmpPath)
+		if err == upload.ErrMaxSize {
+			log.Printf("file %v greater than max file size: %v\n", u.diskPath, u.options.MaxSize())
+		} else {
+			log.Printf("error writing %v: %v\n", tmpPath, err)
+		}
+		return err
+	}
+
+	if hasHash(u.template) {
+		u.render(hex.EncodeToString(hash.Sum(nil)))
+
+		// Same content, same file: drop the copy
+		if u.exists(u.DiskPath()) {
+			u.duplicate = true
+			u.content = nil
+			return u.Storage().Delete(tmpPath)
+		}
+	}
+
+	if hasHash(u.template) || u.options.Collision() == option.CollisionOverwrite {
+		if err := u.Storage().Rename(tmpPath, u.DiskPath()); err != nil {
+			u.Storage().Delete(tmpPath)
+			log.Printf("error moving %v: %v\n", u.DiskPath(), err)
+			return err
+		}
+	} else {
+		err := u.store(func() (io.ReadCloser, error) {
+			return u.Storage().Get(tmpPath)
+		})
+		u.Storage().Delete(tmpPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	u.content = nil
+
+	return nil
+}
+
+// Delete deletes one file from storage. Duplicates are left in storage as earlier uploads own their content.
 func (u *Generic) Delete() error {
-	if err := os.Remove(u.DiskPath()); err != nil {
+	if u.duplicate {
+		return nil
+	}
+
+	if err := u.Storage().Delete(u.DiskPath()); err != nil {
 		return err
 	}
+
+	if events := u.options.Events(); events != nil {
+		events.Emit(upload.Event{Type: upload.EventDeleted, File: u})
+	}
 	return nil
 }
 
-// ChangeExt changes the extension of file on disk
+// ChangeExt changes the extension of file in storage
 func (u *Generic) ChangeExt(newExt string) error {
 	if newExt == "" {
 		return nil
@@ -101,17 +226,144 @@ func (u *Generic) ChangeExt(newExt string) error {
 	newFileDiskPath := strings.TrimSuffix(u.DiskPath(), oldExt) + "." + newExt
 	newFileURLPath := strings.TrimSuffix(u.URLPath(), oldExt) + "." + newExt
 
-	if err := os.Rename(u.DiskPath(), newFileDiskPath); err != nil {
-		return fmt.Errorf("image ext change to %v failed", newExt)
+	if newFileDiskPath == u.DiskPath() {
+		return nil
+	}
+
+	switch {
+	case hasHash(u.template) && u.exists(newFileDiskPath):
+		// File named after its content already stored with the new extension
+		if !u.duplicate {
+			if err := u.Storage().Delete(u.DiskPath()); err != nil {
+				return err
+			}
+		}
+
+		u.duplicate = true
+	case !u.duplicate && (hasHash(u.template) || u.options.Collision() == option.CollisionOverwrite):
+		if err := u.Storage().Rename(u.DiskPath(), newFileDiskPath); err != nil {
+			return fmt.Errorf("image ext change to %v failed", newExt)
+		}
+	default:
+		// Do not replace another file already named with the new extension,
+		// nor move a duplicate away from the earlier uploads owning it
+		duplicate := u.duplicate
+		oldDiskPath, oldURLPath := u.DiskPath(), u.URLPath()
+		u.setPaths(newFileDiskPath, newFileURLPath)
+		u.duplicate = false
+
+		err := u.store(func() (io.ReadCloser, error) {
+			return u.Storage().Get(oldDiskPath)
+		})
+		if err != nil {
+			u.diskPath, u.url, u.duplicate = oldDiskPath, oldURLPath, duplicate
+			return err
+		}
+
+		if !duplicate {
+			if err := u.Storage().Delete(oldDiskPath); err != nil {
+				log.Printf("error deleting %v: %v\n", oldDiskPath, err)
+			}
+		}
+
+		// Paths are set by store
+		return nil
 	}
 
 	// if everything ok, update paths
-	u.diskPath = newFileDiskPath
-	u.url = newFileURLPath
+	u.setPaths(newFileDiskPath, newFileURLPath)
 
 	return nil
 }
 
+// Storage returns the storage holding the file
+func (u *Generic) Storage() upload.Storage {
+	return u.options.Storage()
+}
+
+// Duplicate returns whether the file content was already stored before being saved
+func (u *Generic) Duplicate() bool {
+	return u.duplicate
+}
+
+// RemovedMetadata returns the metadata segments removed from the file content before it was saved
+func (u *Generic) RemovedMetadata() []upload.MetadataSegment {
+	return u.removed
+}
+
+// SetRemovedMetadata sets the metadata segments removed from the file content before it was saved
+func (u *Generic) SetRemovedMetadata(segments []upload.MetadataSegment) {
+	u.removed = segments
+}
+
+// Metadata returns the metadata of the file content as uploaded
+func (u *Generic) Metadata() *upload.Metadata {
+	return u.metadata
+}
+
+// SetMetadata sets the metadata of the file content as uploaded
+func (u *Generic) SetMetadata(m *upload.Metadata) {
+	u.metadata = m
+}
+
+// store writes content at the path of file, handling collisions with existing files
+func (u *Generic) store(open func() (io.ReadCloser, error)) error {
+	for attempt := 0; ; attempt++ {
+		r, err := open()
+		if err != nil {
+			return err
+		}
+
+		if u.options.Collision() == option.CollisionOverwrite {
+			err = u.Storage().Put(u.DiskPath(), r)
+		} else {
+			err = u.Storage().Create(u.DiskPath(), r)
+		}
+		r.Close()
+
+		switch {
+		case err == nil:
+			return nil
+		case err != upload.ErrFileExists:
+			log.Printf("error writing %v: %v\n", u.DiskPath(), err)
+			return err
+		case hasHash(u.template):
+			// Same content stored meanwhile
+			u.duplicate = true
+			return nil
+		case u.options.Collision() == option.CollisionFail || attempt == maxCollisionAttempts:
+			log.Printf("file %v already exists\n", u.DiskPath())
+			return err
+		}
+
+		token := randomHex(collisionTokenLength)
+		u.setPaths(addSuffix(u.DiskPath(), token), addSuffix(u.URLPath(), token))
+	}
+}
+
+// setPaths sets the disk and url path of file
+func (u *Generic) setPaths(diskPath, urlPath string) {
+	// Storage serving its own files dictates the url
+	if urler, ok := u.Storage().(upload.StorageURLer); ok {
+		urlPath = urler.URL(diskPath)
+	}
+
+	u.diskPath = diskPath
+	u.url = urlPath
+}
+
+// render sets the paths of file from its path template
+func (u *Generic) render(hash string) {
+	relPath := renderPath(u.template, u.options.Destination(), u.name, u.createdAt, hash)
+	u.setPaths(filepath.Join(u.options.Dir(), relPath), path.Join(u.options.MediaPrefixURL(), relPath))
+}
+
+// exists checks if a file exists in storage
+func (u *Generic) exists(diskPath string) bool {
+	_, err := u.Storage().Stat(diskPath)
+	return err == nil
+}
+
 // AddTimestamp add timestamp information to a filename
 func AddTimestamp(oldFilename string) string {
 	oldExt := filepath.Ext(oldFilename)
@@ -14,7 +14,7 @@ type MockGeneric struct {
 	url      string
 	diskPath string
 	content  []byte
-	options  upload.Options
+	storage  upload.Storage
 }
 
 // NewMockGeneric returns a new MockGeneric (used for testing image processing so far)
@@ -33,6 +33,7 @@ func NewMockGeneric(name string, opts ...func(upload.Options)) *MockGeneric {
 		url:      urlPath,
 		diskPath: diskPath,
 		content:  content,
+		storage:  options.Storage(),
 	}
 }
 
@@ -68,3 +69,8 @@ func (m *MockGeneric) ChangeExt(string) error {
 	// Don't need an actual implementation
 	return nil
 }
+
+// Storage returns the Storage
+func (m *MockGeneric) Storage() upload.Storage {
+	return m.storage
+}
@@ -0,0 +1,36 @@
+package file
+
+import (
+	"io"
+	"path"
+
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/option"
+)
+
+// maxSizeReader fails with upload.ErrMaxSize once more than max bytes were read
+type maxSizeReader struct {
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+// NewMaxSizeReader returns a reader failing with upload.ErrMaxSize once more than max bytes were read from r
+func NewMaxSizeReader(r io.Reader, max int) io.Reader {
+	return &maxSizeReader{r: r, max: int64(max)}
+}
+
+func (m *maxSizeReader) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	m.read += int64(n)
+	if m.max != option.NoLimit && m.read > m.max {
+		return n, upload.ErrMaxSize
+	}
+
+	return n, err
+}
+
+// tempPath returns a hidden, unique path next to diskPath
+func tempPath(diskPath string) string {
+	return path.Join(path.Dir(diskPath), "."+path.Base(diskPath)+"."+randomHex(8)+".tmp")
+}
@@ -0,0 +1,138 @@
+package file
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosimple/slug"
+)
+
+// Path template tokens:
+//
+//	{dest}           Options.Destination()
+//	{yyyy} {mm} {dd} upload date
+//	{month}          upload month name (e.g October)
+//	{timestamp}      upload time as 20060102150405
+//	{name}           original file name without extension
+//	{slug}           slug of the original file name without extension
+//	{ext}            lower case extension of the original file name, with dot
+//	{uuid}           random UUID (v4)
+//	{ulid}           ULID
+//	{hash}           SHA-256 of the content, {hash:i:j} for its [i:j] slice
+var pathToken = regexp.MustCompile(`\{([a-z]+)(?::(\d+):(\d+))?\}`)
+
+const (
+	// crockford is the ULID base32 alphabet
+	crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+	// sha256HexLength is the length of an hex encoded SHA-256
+	sha256HexLength = 64
+)
+
+// contentTemplate returns the path template of content addressed files sharded depth times
+func contentTemplate(depth int) string {
+	parts := []string{"{dest}"}
+	for i := 0; i < depth && 2*i+2 <= sha256HexLength; i++ {
+		parts = append(parts, fmt.Sprintf("{hash:%d:%d}", 2*i, 2*i+2))
+	}
+
+	return strings.Join(append(parts, "{hash}{ext}"), "/")
+}
+
+// hasHash checks if template needs the content hash
+func hasHash(template string) bool {
+	return strings.Contains(template, "{hash")
+}
+
+// renderPath returns the relative path of a file named name from template
+func renderPath(template, dest, name string, now time.Time, hash string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	rendered := pathToken.ReplaceAllStringFunc(template, func(token string) string {
+		match := pathToken.FindStringSubmatch(token)
+
+		switch match[1] {
+		case "dest":
+			return dest
+		case "yyyy":
+			return fmt.Sprintf("%04d", now.Year())
+		case "mm":
+			return fmt.Sprintf("%02d", now.Month())
+		case "dd":
+			return fmt.Sprintf("%02d", now.Day())
+		case "month":
+			return now.Month().String()
+		case "timestamp":
+			return now.Format("20060102150405")
+		case "name":
+			return strings.NewReplacer("/", "-", "\\", "-").Replace(base)
+		case "slug":
+			return slug.Make(base)
+		case "ext":
+			return strings.ToLower(ext)
+		case "uuid":
+			return newUUID()
+		case "ulid":
+			return newULID(now)
+		case "hash":
+			if match[2] == "" {
+				return hash
+			}
+			i, _ := strconv.Atoi(match[2])
+			j, _ := strconv.Atoi(match[3])
+			if i > j || j > len(hash) {
+				return hash
+			}
+			return hash[i:j]
+		}
+
+		return token
+	})
+
+	// Never escape the upload directory
+	return strings.TrimPrefix(path.Clean("/"+rendered), "/")
+}
+
+// newUUID returns a random (v4) UUID
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// newULID returns a ULID for time t
+func newULID(t time.Time) string {
+	b := make([]byte, 16)
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+	rand.Read(b[6:])
+
+	digits := new(big.Int).SetBytes(b).Text(32)
+
+	var ulid strings.Builder
+	for i := len(digits); i < 26; i++ {
+		ulid.WriteByte(crockford[0])
+	}
+	for _, d := range digits {
+		v, _ := strconv.ParseInt(string(d), 32, 8)
+		ulid.WriteByte(crockford[v])
+	}
+
+	return ulid.String()
+}
@@ -4,9 +4,14 @@ require (
 	github.com/disintegration/imaging v1.5.0
 	github.com/gosimple/slug v1.4.2
 	github.com/h2non/filetype v1.0.10
-	github.com/rainycape/unidecode v0.0.0-20150907023854-cb7f23ec59be // indirect
 	github.com/stretchr/testify v1.3.0
-	golang.org/x/image v0.0.0-20181116024801-cd38e8056d9b // indirect
+	golang.org/x/image v0.18.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/rainycape/unidecode v0.0.0-20150907023854-cb7f23ec59be // indirect
 )
 
-go 1.13
+go 1.19
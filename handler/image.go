@@ -16,6 +16,15 @@ type HTTPImageDir struct {
 	opts   upload.OptionsImage
 }
 
+// NewHTTPImageDir returns a new HTTPImageDir redirecting missing formats of opts to their original under prefix
+func NewHTTPImageDir(root http.FileSystem, prefix string, opts upload.OptionsImage) *HTTPImageDir {
+	return &HTTPImageDir{
+		root:   root,
+		prefix: prefix,
+		opts:   opts,
+	}
+}
+
 func (h HTTPImageDir) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	p := r.URL.Path
 
@@ -24,7 +33,7 @@ func (h HTTPImageDir) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	formats := h.opts.Formats()
 
 	formats.Each(func(name string, format upload.OptionsFormat) {
-		formatSuffix := "-" + format.Name()
+		formatSuffix := format.Suffix()
 		if strings.HasSuffix(p, formatSuffix) {
 			suffix = formatSuffix
 		}
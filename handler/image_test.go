@@ -0,0 +1,44 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.lsl.digital/lardwaz/upload/handler"
+	"go.lsl.digital/lardwaz/upload/option"
+	utypes "go.lsl.digital/lardwaz/upload/types"
+)
+
+func TestHTTPImageDir(t *testing.T) {
+	opts := option.EvaluateImageOptions(
+		option.Formats(option.FormatName("thumb"), option.FormatWidth(100)),
+		option.Formats(option.FormatName("small"), option.FormatWidth(50), option.FormatOutputType(utypes.TypeWEBP)),
+	)
+	h := handler.NewHTTPImageDir(http.Dir(testDataFolder), "/media", opts)
+
+	tests := []struct {
+		name         string
+		path         string
+		wantCode     int
+		wantLocation string
+	}{
+		{"format", "/photos/normal.jpg-thumb", http.StatusTemporaryRedirect, "/media/photos/normal.jpg"},
+		{"webp format", "/photos/normal.jpg-small.webp", http.StatusTemporaryRedirect, "/media/photos/normal.jpg"},
+		{"webp format without extension", "/photos/normal.jpg-small", http.StatusNotFound, ""},
+		{"unknown format", "/photos/normal.jpg-large", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("ServeHTTP() code = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if got := rec.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("ServeHTTP() location = %q, want %q", got, tt.wantLocation)
+			}
+		})
+	}
+}
@@ -0,0 +1,572 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/option"
+)
+
+// tus protocol constants
+const (
+	tusVersion      = "1.0.0"
+	tusExtensions   = "creation,termination,checksum"
+	tusChecksums    = "md5,sha1,sha256"
+	tusContentType  = "application/offset+octet-stream"
+	tusDir          = ".tus"
+	tusChunkPrefix  = "chunk-"
+	tusInfoName     = "info"
+	tusIDLength     = 16
+	tusStatusBadSum = 460 // Checksum Mismatch
+)
+
+// HTTPTus is an http.Handler implementing the tus 1.0 resumable upload protocol
+// along with its creation, termination and checksum extensions.
+// Chunks are kept in storage under Options.Dir()/.tus until the upload is complete;
+// the assembled file then goes through the uploader like any other upload.
+// The state of finished uploads is kept until they are terminated.
+type HTTPTus struct {
+	uploader upload.StreamUploader
+	opts     upload.Options
+	prefix   string
+	locks    sync.Map
+}
+
+// tusInfo holds the state of a resumable upload
+type tusInfo struct {
+	ID       string            `json:"id"`
+	Length   int64             `json:"length"`
+	Offset   int64             `json:"offset"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	URLPath  string            `json:"url,omitempty"` // Set once complete
+}
+
+// NewHTTPTus returns a new HTTPTus served under prefix (e.g /files/).
+// opts must be the options of uploader.
+func NewHTTPTus(uploader upload.StreamUploader, opts upload.Options, prefix string) *HTTPTus {
+	return &HTTPTus{
+		uploader: uploader,
+		opts:     opts,
+		prefix:   "/" + strings.Trim(prefix, "/") + "/",
+	}
+}
+
+func (h *HTTPTus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", tusExtensions)
+		w.Header().Set("Tus-Checksum-Algorithm", tusChecksums)
+		if h.opts.MaxSize() != option.NoLimit {
+			w.Header().Set("Tus-Max-Size", strconv.Itoa(h.opts.MaxSize()))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, h.prefix), "/")
+
+	// Ids are part of storage paths, so anything create does not generate is unknown
+	if id != "" && !isTusID(id) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && id == "":
+		h.create(w, r)
+	case r.Method == http.MethodHead && id != "":
+		h.head(w, r, id)
+	case r.Method == http.MethodPatch && id != "":
+		h.patch(w, r, id)
+	case r.Method == http.MethodDelete && id != "":
+		h.terminate(w, r, id)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// create starts a new upload (creation extension)
+func (h *HTTPTus) create(w http.ResponseWriter, r *http.Request) {
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+
+	if h.opts.MaxSize() != option.NoLimit && length > int64(h.opts.MaxSize()) {
+		http.Error(w, upload.ErrMaxSize.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token := make([]byte, tusIDLength)
+	if _, err := rand.Read(token); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	info := &tusInfo{
+		ID:       hex.EncodeToString(token),
+		Length:   length,
+		Metadata: metadata,
+	}
+
+	if err := h.save(info); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", h.prefix+info.ID)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// head returns the current offset of an upload
+func (h *HTTPTus) head(w http.ResponseWriter, r *http.Request, id string) {
+	info, err := h.load(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	h.describe(w, info)
+	w.WriteHeader(http.StatusOK)
+}
+
+// patch appends a chunk to an upload, completing it once all bytes were received
+func (h *HTTPTus) patch(w http.ResponseWriter, r *http.Request, id string) {
+	unlock := h.lock(id)
+	defer unlock()
+
+	if r.Header.Get("Content-Type") != tusContentType {
+		http.Error(w, "invalid Content-Type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	info, err := h.load(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	if offset != info.Offset {
+		http.Error(w, "Upload-Offset mismatch", http.StatusConflict)
+		return
+	}
+
+	checksum, expected, err := parseTusChecksum(r.Header.Get("Upload-Checksum"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A finished upload has nothing left to receive
+	if info.URLPath != "" {
+		h.describe(w, info)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	chunkPath := h.path(id, fmt.Sprintf("%s%020d", tusChunkPrefix, offset))
+	counter := &countingReader{r: io.LimitReader(r.Body, info.Length-info.Offset)}
+	cut := &cutReader{r: counter}
+
+	var body io.Reader = cut
+	if checksum != nil {
+		body = io.TeeReader(cut, checksum)
+	}
+
+	if err := h.opts.Storage().Put(chunkPath, body); err != nil {
+		h.opts.Storage().Delete(chunkPath)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Bytes received before the request was cut off are kept, unless they cannot be verified
+	if cut.err != nil && (checksum != nil || counter.n == 0) {
+		h.opts.Storage().Delete(chunkPath)
+		http.Error(w, cut.err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if checksum != nil && !bytes.Equal(checksum.Sum(nil), expected) {
+		h.opts.Storage().Delete(chunkPath)
+		http.Error(w, "checksum mismatch", tusStatusBadSum)
+		return
+	}
+
+	info.Offset += counter.n
+
+	if info.Offset == info.Length {
+		h.finish(w, info)
+		return
+	}
+
+	if err := h.save(info); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if cut.err != nil {
+		http.Error(w, cut.err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.describe(w, info)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// finish completes an upload whose bytes were all received.
+// Its chunks go once the upload succeeded or was refused, its state being kept as a record of the finished upload.
+// Chunks are kept on other failures so the last chunk can be sent again.
+func (h *HTTPTus) finish(w http.ResponseWriter, info *tusInfo) {
+	// The upload outlives the connection of the client sending its last bytes
+	err := h.complete(context.Background(), info)
+	if err != nil && statusCode(err) >= http.StatusInternalServerError {
+		log.Printf("error completing tus upload %v: %v", info.ID, err)
+		http.Error(w, err.Error(), statusCode(err))
+		return
+	}
+
+	if err != nil {
+		if err := h.remove(info.ID); err != nil {
+			log.Printf("error removing tus upload %v: %v", info.ID, err)
+		}
+		h.locks.Delete(info.ID)
+
+		http.Error(w, err.Error(), statusCode(err))
+		return
+	}
+
+	if err := h.removeChunks(info.ID); err != nil {
+		log.Printf("error removing tus upload chunks %v: %v", info.ID, err)
+	}
+	if err := h.save(info); err != nil {
+		log.Printf("error saving tus upload %v: %v", info.ID, err)
+	}
+
+	h.describe(w, info)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// terminate deletes an upload (termination extension)
+func (h *HTTPTus) terminate(w http.ResponseWriter, r *http.Request, id string) {
+	unlock := h.lock(id)
+	defer unlock()
+
+	if _, err := h.load(id); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if err := h.remove(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.locks.Delete(id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// complete feeds the assembled chunks to the uploader
+func (h *HTTPTus) complete(ctx context.Context, info *tusInfo) error {
+	chunks, err := h.chunks(info.ID)
+	if err != nil {
+		return err
+	}
+
+	name := info.Metadata["filename"]
+	if name == "" {
+		name = info.ID
+	}
+
+	content := &chunkReader{storage: h.opts.Storage(), paths: chunks}
+	defer content.Close()
+
+	uploaded, err := h.uploader.UploadReader(ctx, name, content, info.Length)
+	if err != nil {
+		return err
+	}
+	info.URLPath = uploaded.URLPath()
+
+	return nil
+}
+
+// describe sets the headers describing an upload
+func (h *HTTPTus) describe(w http.ResponseWriter, info *tusInfo) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(info.Length, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	if len(info.Metadata) > 0 {
+		w.Header().Set("Upload-Metadata", formatTusMetadata(info.Metadata))
+	}
+	if info.URLPath != "" {
+		w.Header().Set("Upload-File-Url", info.URLPath)
+	}
+}
+
+// lock prevents concurrent changes to the same upload
+func (h *HTTPTus) lock(id string) func() {
+	mu, _ := h.locks.LoadOrStore(id, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+
+	return mu.(*sync.Mutex).Unlock
+}
+
+// isTusID checks if id is formatted as the ids generated by create
+func isTusID(id string) bool {
+	if len(id) != hex.EncodedLen(tusIDLength) {
+		return false
+	}
+
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// path returns the storage path of name belonging to upload id
+func (h *HTTPTus) path(id, name string) string {
+	return path.Join(h.opts.Dir(), tusDir, id, name)
+}
+
+func (h *HTTPTus) load(id string) (*tusInfo, error) {
+	r, err := h.opts.Storage().Get(h.path(id, tusInfoName))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var info tusInfo
+	if err := json.NewDecoder(r).Decode(&info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+func (h *HTTPTus) save(info *tusInfo) error {
+	content, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	return h.opts.Storage().Put(h.path(info.ID, tusInfoName), bytes.NewReader(content))
+}
+
+// chunks returns the sorted storage paths of chunks received for upload id
+func (h *HTTPTus) chunks(id string) ([]string, error) {
+	paths, err := h.opts.Storage().List(h.path(id, tusChunkPrefix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// remove deletes chunks and state of upload id
+func (h *HTTPTus) remove(id string) error {
+	if err := h.removeChunks(id); err != nil {
+		return err
+	}
+
+	return h.opts.Storage().Delete(h.path(id, tusInfoName))
+}
+
+// removeChunks deletes chunks of upload id
+func (h *HTTPTus) removeChunks(id string) error {
+	chunks, err := h.chunks(id)
+	if err != nil {
+		return err
+	}
+
+	for _, chunk := range chunks {
+		if err := h.opts.Storage().Delete(chunk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// chunkReader reads chunks one after the other, opening each only when needed
+type chunkReader struct {
+	storage upload.Storage
+	paths   []string
+	current io.ReadCloser
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if c.current == nil {
+			if len(c.paths) == 0 {
+				return 0, io.EOF
+			}
+
+			r, err := c.storage.Get(c.paths[0])
+			if err != nil {
+				return 0, err
+			}
+			c.current, c.paths = r, c.paths[1:]
+		}
+
+		n, err := c.current.Read(p)
+		if err == io.EOF {
+			c.current.Close()
+			c.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+
+		return n, err
+	}
+}
+
+func (c *chunkReader) Close() error {
+	if c.current == nil {
+		return nil
+	}
+
+	return c.current.Close()
+}
+
+// cutReader ends at the first read error, kept in err, so bytes read before can be stored
+type cutReader struct {
+	r   io.Reader
+	err error
+}
+
+func (c *cutReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err != nil && err != io.EOF {
+		c.err, err = err, io.EOF
+	}
+
+	return n, err
+}
+
+// countingReader counts bytes read
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+
+	return n, err
+}
+
+// parseTusMetadata decodes an Upload-Metadata header ("key base64value,key2 base64value2")
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("invalid Upload-Metadata")
+		}
+
+		var value []byte
+		if len(fields) == 2 {
+			var err error
+			if value, err = base64.StdEncoding.DecodeString(fields[1]); err != nil {
+				return nil, fmt.Errorf("invalid Upload-Metadata: %v", err)
+			}
+		}
+
+		metadata[fields[0]] = string(value)
+	}
+
+	return metadata, nil
+}
+
+// formatTusMetadata encodes metadata as an Upload-Metadata header
+func formatTusMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+" "+base64.StdEncoding.EncodeToString([]byte(metadata[key])))
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// parseTusChecksum decodes an Upload-Checksum header ("algorithm base64sum")
+func parseTusChecksum(header string) (hash.Hash, []byte, error) {
+	if header == "" {
+		return nil, nil, nil
+	}
+
+	fields := strings.Fields(header)
+	if len(fields) != 2 {
+		return nil, nil, fmt.Errorf("invalid Upload-Checksum")
+	}
+
+	sum, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid Upload-Checksum: %v", err)
+	}
+
+	switch fields[0] {
+	case "md5":
+		return md5.New(), sum, nil
+	case "sha1":
+		return sha1.New(), sum, nil
+	case "sha256":
+		return sha256.New(), sum, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported checksum algorithm %v", fields[0])
+	}
+}
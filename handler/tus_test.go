@@ -0,0 +1,345 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/handler"
+	"go.lsl.digital/lardwaz/upload/option"
+	"go.lsl.digital/lardwaz/upload/storage"
+	utypes "go.lsl.digital/lardwaz/upload/types"
+	"go.lsl.digital/lardwaz/upload/uploader"
+)
+
+// tusRequest serves a tus request and returns the recorded response
+func tusRequest(h http.Handler, method, target string, headers map[string]string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func newTus(opts ...func(upload.Options)) (*handler.HTTPTus, *storage.Memory) {
+	memStorage := storage.NewMemory()
+	options := option.EvaluateOptions(append([]func(upload.Options){
+		option.Storage(memStorage),
+		option.FileType(utypes.TypePDF),
+	}, opts...)...)
+
+	return handler.NewHTTPTus(&uploader.Generic{Options: options}, options, "/files/"), memStorage
+}
+
+// tusCreate creates an upload of length bytes and returns its location
+func tusCreate(t *testing.T, h http.Handler, length int) string {
+	rec := tusRequest(h, http.MethodPost, "/files/", map[string]string{
+		"Upload-Length":   strconv.Itoa(length),
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("report.pdf")),
+	}, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST code = %d, want %d", rec.Code, http.StatusCreated)
+	}
+
+	return rec.Header().Get("Location")
+}
+
+func tusPatch(h http.Handler, location string, offset int, chunk []byte, checksum string) *httptest.ResponseRecorder {
+	headers := map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": strconv.Itoa(offset),
+	}
+	if checksum != "" {
+		headers["Upload-Checksum"] = checksum
+	}
+
+	return tusRequest(h, http.MethodPatch, location, headers, chunk)
+}
+
+func TestHTTPTus(t *testing.T) {
+	content, err := ioutil.ReadFile(filepath.Join(testDataFolder, "normal.pdf"))
+	if err != nil {
+		t.Fatalf("Cannot open input file: %v", err)
+	}
+	half := len(content) / 2
+
+	h, memStorage := newTus()
+	location := tusCreate(t, h, len(content))
+
+	if rec := tusPatch(h, location, 0, content[:half], ""); rec.Code != http.StatusNoContent || rec.Header().Get("Upload-Offset") != strconv.Itoa(half) {
+		t.Fatalf("PATCH code = %d offset = %s, want %d %d", rec.Code, rec.Header().Get("Upload-Offset"), http.StatusNoContent, half)
+	}
+
+	// Resume: ask for the offset first
+	rec := tusRequest(h, http.MethodHead, location, nil, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Upload-Offset") != strconv.Itoa(half) {
+		t.Fatalf("HEAD code = %d offset = %s, want %d %d", rec.Code, rec.Header().Get("Upload-Offset"), http.StatusOK, half)
+	}
+
+	if rec := tusPatch(h, location, 0, content[half:], ""); rec.Code != http.StatusConflict {
+		t.Errorf("PATCH wrong offset code = %d, want %d", rec.Code, http.StatusConflict)
+	}
+
+	if rec := tusPatch(h, location, half, content[half:], "sha1 "+base64.StdEncoding.EncodeToString([]byte("wrong"))); rec.Code != 460 {
+		t.Errorf("PATCH bad checksum code = %d, want %d", rec.Code, 460)
+	}
+
+	sum := sha1.Sum(content[half:])
+	rec = tusPatch(h, location, half, content[half:], "sha1 "+base64.StdEncoding.EncodeToString(sum[:]))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("PATCH code = %d, want %d (%s)", rec.Code, http.StatusNoContent, rec.Body)
+	}
+
+	urlPath := rec.Header().Get("Upload-File-Url")
+	if filepath.Ext(urlPath) != ".pdf" {
+		t.Errorf("PATCH Upload-File-Url = %s, want a .pdf url", urlPath)
+	}
+
+	// Only the assembled file and the record of the upload remain
+	var stored []byte
+	for _, key := range memStorage.Keys() {
+		if filepath.Ext(key) == ".pdf" {
+			stored, _ = memStorage.Bytes(key)
+		}
+		if strings.Contains(key, "chunk-") {
+			t.Errorf("chunk %s left after completion", key)
+		}
+	}
+	if !bytes.Equal(stored, content) {
+		t.Errorf("assembled file content invalid (%d bytes, want %d)", len(stored), len(content))
+	}
+
+	rec = tusRequest(h, http.MethodHead, location, nil, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Upload-Offset") != strconv.Itoa(len(content)) || rec.Header().Get("Upload-File-Url") != urlPath {
+		t.Errorf("HEAD after completion code = %d headers = %v, want %d with full offset", rec.Code, rec.Header(), http.StatusOK)
+	}
+
+	// Finished uploads are not uploaded again
+	writes := memStorage.Writes()
+	if rec := tusPatch(h, location, len(content), nil, ""); rec.Code != http.StatusNoContent || memStorage.Writes() != writes {
+		t.Errorf("PATCH after completion code = %d writes = %d, want %d %d", rec.Code, memStorage.Writes(), http.StatusNoContent, writes)
+	}
+}
+
+// cutBody returns content then fails as a connection cut off
+type cutBody struct {
+	content []byte
+}
+
+func (b *cutBody) Read(p []byte) (int, error) {
+	if len(b.content) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	n := copy(p, b.content)
+	b.content = b.content[n:]
+
+	return n, nil
+}
+
+func TestHTTPTusCutOff(t *testing.T) {
+	content, err := ioutil.ReadFile(filepath.Join(testDataFolder, "normal.pdf"))
+	if err != nil {
+		t.Fatalf("Cannot open input file: %v", err)
+	}
+	half := len(content) / 2
+
+	patch := func(h http.Handler, location string, body io.Reader, checksum string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, location, body)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Content-Type", "application/offset+octet-stream")
+		req.Header.Set("Upload-Offset", "0")
+		if checksum != "" {
+			req.Header.Set("Upload-Checksum", checksum)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	tests := []struct {
+		name       string
+		checksum   string
+		wantOffset int
+	}{
+		{"kept", "", half},
+		{"unverifiable", "sha1 " + base64.StdEncoding.EncodeToString(make([]byte, sha1.Size)), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, memStorage := newTus()
+			location := tusCreate(t, h, len(content))
+
+			// The whole file sent at once, cut off halfway
+			if rec := patch(h, location, &cutBody{content: content[:half]}, tt.checksum); rec.Code != http.StatusBadRequest {
+				t.Errorf("PATCH cut off code = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+
+			rec := tusRequest(h, http.MethodHead, location, nil, nil)
+			if rec.Header().Get("Upload-Offset") != strconv.Itoa(tt.wantOffset) {
+				t.Fatalf("HEAD offset = %s, want %d", rec.Header().Get("Upload-Offset"), tt.wantOffset)
+			}
+
+			// Resumed from the bytes received
+			if rec := tusPatch(h, location, tt.wantOffset, content[tt.wantOffset:], ""); rec.Code != http.StatusNoContent {
+				t.Fatalf("PATCH code = %d, want %d (%s)", rec.Code, http.StatusNoContent, rec.Body)
+			}
+
+			for _, key := range memStorage.Keys() {
+				if stored, _ := memStorage.Bytes(key); filepath.Ext(key) == ".pdf" && !bytes.Equal(stored, content) {
+					t.Errorf("assembled file content invalid (%d bytes, want %d)", len(stored), len(content))
+				}
+			}
+		})
+	}
+}
+
+// flakyStorage fails writes outside of tus chunks and state while failing is set
+type flakyStorage struct {
+	*storage.Memory
+	failing bool
+}
+
+func (s *flakyStorage) Put(p string, r io.Reader) error {
+	if s.failing && !strings.Contains(p, ".tus") {
+		return errors.New("storage unavailable")
+	}
+
+	return s.Memory.Put(p, r)
+}
+
+func TestHTTPTusCompleteFailure(t *testing.T) {
+	content, err := ioutil.ReadFile(filepath.Join(testDataFolder, "normal.pdf"))
+	if err != nil {
+		t.Fatalf("Cannot open input file: %v", err)
+	}
+	half := len(content) / 2
+
+	flaky := &flakyStorage{Memory: storage.NewMemory()}
+	options := option.EvaluateOptions(option.Storage(flaky), option.FileType(utypes.TypePDF))
+	h := handler.NewHTTPTus(&uploader.Generic{Options: options}, options, "/files/")
+
+	location := tusCreate(t, h, len(content))
+	if rec := tusPatch(h, location, 0, content[:half], ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("PATCH code = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	flaky.failing = true
+	if rec := tusPatch(h, location, half, content[half:], ""); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("PATCH failing storage code = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+
+	// Kept for the last chunk to be sent again
+	rec := tusRequest(h, http.MethodHead, location, nil, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Upload-Offset") != strconv.Itoa(half) {
+		t.Fatalf("HEAD code = %d offset = %s, want %d %d", rec.Code, rec.Header().Get("Upload-Offset"), http.StatusOK, half)
+	}
+
+	// Completed even though the client is gone
+	flaky.failing = false
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodPatch, location, bytes.NewReader(content[half:])).WithContext(ctx)
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", strconv.Itoa(half))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Upload-File-Url") == "" {
+		t.Fatalf("PATCH code = %d, want %d (%s)", rec.Code, http.StatusNoContent, rec.Body)
+	}
+}
+
+func TestHTTPTusTerminate(t *testing.T) {
+	h, memStorage := newTus()
+	location := tusCreate(t, h, 10)
+
+	if rec := tusPatch(h, location, 0, []byte("%PDF-"), ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("PATCH code = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	if rec := tusRequest(h, http.MethodDelete, location, nil, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE code = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	if rec := tusRequest(h, http.MethodHead, location, nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("HEAD after DELETE code = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if keys := memStorage.Keys(); len(keys) != 0 {
+		t.Errorf("storage keys = %v, want none", keys)
+	}
+}
+
+func TestHTTPTusInvalidID(t *testing.T) {
+	h, memStorage := newTus()
+
+	// Files outside the tus directory, as reached by an id holding ../
+	dir := option.NewUpload().Dir()
+	outside := []string{path.Join(dir, "secret", "info"), path.Join(dir, "secret", "chunk-00000000000000000000")}
+	for _, p := range outside {
+		memStorage.Put(p, strings.NewReader(`{"id":"secret","length":10}`))
+	}
+
+	for _, target := range []string{"/files/../secret", "/files/..%2Fsecret", "/files/ABCDEF0123456789ABCDEF0123456789", "/files/0123"} {
+		for _, method := range []string{http.MethodHead, http.MethodPatch, http.MethodDelete} {
+			rec := tusRequest(h, method, target, map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": "0"}, []byte("data"))
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("%s %s code = %d, want %d", method, target, rec.Code, http.StatusNotFound)
+			}
+		}
+	}
+
+	for _, p := range outside {
+		if content, ok := memStorage.Bytes(p); !ok || !strings.HasPrefix(string(content), `{"id"`) {
+			t.Errorf("%s changed or deleted", p)
+		}
+	}
+}
+
+func TestHTTPTusErrors(t *testing.T) {
+	h, memStorage := newTus(option.MaxSize(100))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, "/files/", nil))
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Tus-Max-Size") != "100" || rec.Header().Get("Tus-Extension") == "" {
+		t.Errorf("OPTIONS code = %d headers = %v", rec.Code, rec.Header())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/files/", nil))
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("POST without Tus-Resumable code = %d, want %d", rec.Code, http.StatusPreconditionFailed)
+	}
+
+	if rec := tusRequest(h, http.MethodPost, "/files/", map[string]string{"Upload-Length": "101"}, nil); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("POST too large code = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+
+	// Completed upload of an unknown type is rejected and cleaned up
+	location := tusCreate(t, h, 5)
+	if rec := tusPatch(h, location, 0, []byte("hello"), ""); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("PATCH unknown type code = %d, want %d", rec.Code, http.StatusUnsupportedMediaType)
+	}
+	if keys := memStorage.Keys(); len(keys) != 0 {
+		t.Errorf("storage keys = %v, want none", keys)
+	}
+}
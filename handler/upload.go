@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/h2non/filetype"
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/file"
+)
+
+// duplicate represents an uploaded file whose content was already stored
+type duplicate interface {
+	Duplicate() bool
+}
+
+// HTTPUpload is an http.Handler that uploads files posted as multipart/form-data.
+// Each file goes through the uploader and, if set, the image processor.
+// Files are described in a JSON response.
+// Options.MaxSize limits each file; wrap it in http.MaxBytesHandler to also limit whole requests,
+// failing with 413 Request Entity Too Large.
+type HTTPUpload struct {
+	uploader  upload.Uploader
+	processor upload.ImageProcessor
+	opts      upload.Options
+}
+
+// UploadResponse is the JSON response of HTTPUpload
+type UploadResponse struct {
+	Files []UploadedFile `json:"files,omitempty"`
+	Error string         `json:"error,omitempty"`
+}
+
+// UploadedFile describes a file uploaded through HTTPUpload
+type UploadedFile struct {
+	Name    string            `json:"name"`
+	URLPath string            `json:"url"`
+	Type    string            `json:"type"`
+	Size    int64             `json:"size"`
+	Formats map[string]string `json:"formats,omitempty"`
+}
+
+// NewHTTPUpload returns a new HTTPUpload. opts must be the options of uploader
+// and processor may be nil if files need no processing.
+func NewHTTPUpload(uploader upload.Uploader, opts upload.Options, processor upload.ImageProcessor) *HTTPUpload {
+	return &HTTPUpload{
+		uploader:  uploader,
+		processor: processor,
+		opts:      opts,
+	}
+}
+
+func (h HTTPUpload) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		h.fail(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		h.fail(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var (
+		uploads []upload.Uploaded
+		res     UploadResponse
+	)
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			h.rollback(uploads, nil)
+			if code := statusCode(err); code == http.StatusRequestEntityTooLarge {
+				h.fail(w, code, err)
+			} else {
+				h.fail(w, http.StatusBadRequest, err)
+			}
+			return
+		}
+
+		// Skip regular form fields
+		if part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		uploaded, err := h.upload(r, part)
+		part.Close()
+		if err != nil {
+			h.rollback(uploads, nil)
+			h.fail(w, statusCode(err), err)
+			return
+		}
+		uploads = append(uploads, uploaded)
+
+		res.Files = append(res.Files, h.describe(part.FileName(), uploaded))
+	}
+
+	if len(uploads) == 0 {
+		h.fail(w, http.StatusBadRequest, errors.New("no file uploaded"))
+		return
+	}
+
+	if h.processor != nil {
+		// Jobs outlive the request, unless it fails
+		ctx, cancel := context.WithCancel(context.Background())
+		var jobs []upload.Job
+		for _, uploaded := range uploads {
+			job, err := h.process(ctx, uploaded)
+			if err != nil {
+				cancel()
+				h.rollback(uploads, jobs)
+				h.fail(w, statusCode(err), err)
+				return
+			}
+			jobs = append(jobs, job)
+		}
+
+		// The context is released once the jobs are over
+		go func() {
+			for _, job := range jobs {
+				job.Wait(context.Background())
+			}
+			cancel()
+		}()
+	}
+
+	h.respond(w, http.StatusOK, res)
+}
+
+// upload streams part to the uploader when supported
+func (h HTTPUpload) upload(r *http.Request, part *multipart.Part) (upload.Uploaded, error) {
+	name := part.FileName()
+	body := file.NewMaxSizeReader(partReader{part}, h.opts.MaxSize())
+
+	if streamer, ok := h.uploader.(upload.StreamUploader); ok {
+		return streamer.UploadReader(r.Context(), name, body, -1)
+	}
+
+	content, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.uploader.Upload(name, content)
+}
+
+// process adds a job processing uploaded, stopped once ctx is done when supported
+func (h HTTPUpload) process(ctx context.Context, uploaded upload.Uploaded) (upload.Job, error) {
+	if p, ok := h.processor.(upload.ContextProcessor); ok {
+		return p.ProcessContext(ctx, uploaded, true)
+	}
+
+	return h.processor.Process(uploaded, true)
+}
+
+// describe returns the details of an uploaded file
+func (h HTTPUpload) describe(name string, uploaded upload.Uploaded) UploadedFile {
+	file := UploadedFile{
+		Name:    name,
+		URLPath: uploaded.URLPath(),
+		Type:    filetype.GetType(strings.TrimPrefix(path.Ext(uploaded.DiskPath()), ".")).MIME.Value,
+	}
+
+	if info, err := uploaded.Storage().Stat(uploaded.DiskPath()); err == nil {
+		file.Size = info.Size()
+	}
+
+	if h.processor != nil && h.processor.Options().Formats().Length() > 0 {
+		file.Formats = make(map[string]string)
+		h.processor.Options().Formats().Each(func(name string, format upload.OptionsFormat) {
+			if format.Name() != "" {
+				file.Formats[format.Name()] = uploaded.URLPath() + format.Suffix()
+			}
+		})
+	}
+
+	return file
+}
+
+// rollback deletes files uploaded by a failed request, along with the formats written by its jobs once they are over.
+// Duplicates and their formats are kept as earlier uploads own them.
+func (h HTTPUpload) rollback(uploads []upload.Uploaded, jobs []upload.Job) {
+	for _, job := range jobs {
+		result, _ := job.Wait(context.Background())
+		if dup, ok := job.File().(duplicate); ok && dup.Duplicate() {
+			continue
+		}
+		for _, format := range result.Formats {
+			if err := job.File().Storage().Delete(format.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("error deleting format %v: %v", format.Path, err)
+			}
+		}
+	}
+
+	for _, uploaded := range uploads {
+		uploaded.Delete()
+	}
+}
+
+func (h HTTPUpload) fail(w http.ResponseWriter, code int, err error) {
+	h.respond(w, code, UploadResponse{Error: err.Error()})
+}
+
+func (h HTTPUpload) respond(w http.ResponseWriter, code int, res UploadResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(res)
+}
+
+// statusCode returns the http status code matching an upload error, storage failures being internal errors
+func statusCode(err error) int {
+	var (
+		tooLarge *http.MaxBytesError
+		partErr  *partError
+	)
+	switch {
+	case errors.Is(err, upload.ErrMaxSize), errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, upload.ErrUnknownType), errors.Is(err, upload.ErrInvalidImage), errors.Is(err, upload.ErrNoConverter):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, upload.ErrFileExists):
+		return http.StatusConflict
+	case errors.Is(err, upload.ErrImageTooSmall), errors.As(err, &partErr):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// partReader reads a multipart part, telling errors reading the request apart from storage failures
+type partReader struct {
+	r io.Reader
+}
+
+func (p partReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if err != nil && err != io.EOF {
+		err = &partError{err: err}
+	}
+
+	return n, err
+}
+
+// partError is an error reading a multipart part
+type partError struct {
+	err error
+}
+
+func (e *partError) Error() string {
+	return e.err.Error()
+}
+
+func (e *partError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,238 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/event"
+	"go.lsl.digital/lardwaz/upload/handler"
+	"go.lsl.digital/lardwaz/upload/option"
+	"go.lsl.digital/lardwaz/upload/processor"
+	"go.lsl.digital/lardwaz/upload/storage"
+	utypes "go.lsl.digital/lardwaz/upload/types"
+	"go.lsl.digital/lardwaz/upload/uploader"
+)
+
+const (
+	testDataFolder = "../testdata"
+)
+
+// multipartBody returns a multipart/form-data body holding files from testdata
+func multipartBody(t *testing.T, files ...string) (*bytes.Buffer, string) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	writer.WriteField("title", "some title")
+	for _, name := range files {
+		content, err := ioutil.ReadFile(filepath.Join(testDataFolder, name))
+		if err != nil {
+			t.Fatalf("Cannot open input file %s: %v", name, err)
+		}
+
+		part, err := writer.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatalf("CreateFormFile() error = %v", err)
+		}
+		part.Write(content)
+	}
+	writer.Close()
+
+	return &body, writer.FormDataContentType()
+}
+
+func TestHTTPUpload(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		files        []string
+		opts         []func(upload.Options)
+		wantCode     int
+		wantFiles    int
+		wantFormats  int
+		useProcessor bool
+	}{
+		{"image", http.MethodPost, []string{"normal.jpg"}, nil, http.StatusOK, 1, 1, true},
+		{"multiple", http.MethodPost, []string{"normal.jpg", "normal.png"}, nil, http.StatusOK, 2, 0, false},
+		{"unsupported type", http.MethodPost, []string{"normal.jpg", "normal.txt"}, nil, http.StatusUnsupportedMediaType, 0, 0, false},
+		{"max size", http.MethodPost, []string{"normal.png"}, []func(upload.Options){option.MaxSize(20)}, http.StatusRequestEntityTooLarge, 0, 0, false},
+		{"max size per file", http.MethodPost, []string{"normal.gif", "normal.gif", "normal.gif"}, []func(upload.Options){option.FileType(utypes.TypeGIF), option.MaxSize(1100000)}, http.StatusOK, 3, 0, false},
+		{"file exists", http.MethodPost, []string{"normal.jpg", "normal.jpg"}, []func(upload.Options){option.PathTemplate("{name}{ext}"), option.Collision(option.CollisionFail)}, http.StatusConflict, 0, 0, false},
+		{"no file", http.MethodPost, nil, nil, http.StatusBadRequest, 0, 0, false},
+		{"get", http.MethodGet, nil, nil, http.StatusMethodNotAllowed, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memStorage := storage.NewMemory()
+			opts := option.EvaluateOptions(append([]func(upload.Options){
+				option.Storage(memStorage),
+				option.FileType(utypes.TypeJPEG),
+				option.FileType(utypes.TypePNG),
+			}, tt.opts...)...)
+
+			var imageProcessor upload.ImageProcessor
+			if tt.useProcessor {
+				imageProcessor = processor.NewImage(option.Formats(option.FormatName("thumb"), option.FormatWidth(50), option.FormatHeight(50)))
+			}
+
+			h := handler.NewHTTPUpload(&uploader.Image{Options: opts}, opts, imageProcessor)
+
+			body, contentType := multipartBody(t, tt.files...)
+			req := httptest.NewRequest(tt.method, "/upload", body)
+			req.Header.Set("Content-Type", contentType)
+			rec := httptest.NewRecorder()
+
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("ServeHTTP() code = %d, want %d (%s)", rec.Code, tt.wantCode, rec.Body)
+			}
+
+			var res handler.UploadResponse
+			if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+				t.Fatalf("Cannot decode response: %v", err)
+			}
+
+			if len(res.Files) != tt.wantFiles {
+				t.Fatalf("ServeHTTP() files = %d, want %d", len(res.Files), tt.wantFiles)
+			}
+
+			for i, f := range res.Files {
+				if f.Name != tt.files[i] || f.URLPath == "" || f.Size == 0 || f.Type == "" {
+					t.Errorf("ServeHTTP() file = %+v, want name %s with url, size and type", f, tt.files[i])
+				}
+				if len(f.Formats) != tt.wantFormats {
+					t.Errorf("ServeHTTP() formats = %v, want %d formats", f.Formats, tt.wantFormats)
+				}
+			}
+
+			if tt.wantCode != http.StatusOK && res.Error == "" {
+				t.Errorf("ServeHTTP() error missing in response")
+			}
+
+			// Failed requests must not leave files behind
+			if stored := len(memStorage.Keys()); tt.wantFiles == 0 && stored != 0 {
+				t.Errorf("storage holds %d files, want %d", stored, 0)
+			}
+		})
+	}
+}
+
+func TestHTTPUploadTruncated(t *testing.T) {
+	memStorage := storage.NewMemory()
+	opts := option.EvaluateOptions(option.Storage(memStorage), option.FileType(utypes.TypeJPEG))
+	h := handler.NewHTTPUpload(&uploader.Image{Options: opts}, opts, nil)
+
+	// The request ends in the middle of the file
+	body, contentType := multipartBody(t, "normal.jpg")
+	req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(body.Bytes()[:body.Len()/2]))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("ServeHTTP() code = %d, want %d (%s)", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+	if keys := memStorage.Keys(); len(keys) != 0 {
+		t.Errorf("storage holds %v, want no file", keys)
+	}
+}
+
+func TestHTTPUploadRollback(t *testing.T) {
+	memStorage := storage.NewMemory()
+	opts := option.EvaluateOptions(option.Storage(memStorage), option.FileType(utypes.TypeJPEG))
+
+	// The job of the first file is over once it emits
+	bus := event.NewBus(option.DispatchSync)
+	over := make(chan struct{}, 1)
+	bus.OnJobDone(func(upload.Event) { over <- struct{}{} })
+	bus.OnJobFailed(func(upload.Event) { over <- struct{}{} })
+
+	// The first file is processed, the second one is too small
+	imageProcessor := processor.NewImage(
+		option.ImageEvents(bus),
+		option.MinWidth(300),
+		option.Formats(option.FormatName("thumb"), option.FormatWidth(50), option.FormatHeight(50)),
+		option.Formats(option.FormatName("big"), option.FormatWidth(400), option.FormatHeight(300)),
+	)
+
+	h := handler.NewHTTPUpload(&uploader.Image{Options: opts}, opts, imageProcessor)
+
+	body, contentType := multipartBody(t, "normal.jpg", "orientation_1.jpg")
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("ServeHTTP() code = %d, want %d (%s)", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+
+	select {
+	case <-over:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job of the first file not over")
+	}
+
+	// Neither originals nor formats of the first file are left behind
+	if keys := memStorage.Keys(); len(keys) != 0 {
+		t.Errorf("storage holds %v, want no file", keys)
+	}
+}
+
+func TestHTTPUploadRollbackDuplicate(t *testing.T) {
+	memStorage := storage.NewMemory()
+	opts := option.EvaluateOptions(option.Storage(memStorage), option.FileType(utypes.TypeJPEG), option.ContentAddressed(1))
+
+	bus := event.NewBus(option.DispatchSync)
+	done := make(chan struct{}, 1)
+	bus.OnJobDone(func(upload.Event) { done <- struct{}{} })
+
+	// normal.jpg is processed, orientation_1.jpg is too small
+	imageProcessor := processor.NewImage(
+		option.ImageEvents(bus),
+		option.MinWidth(300),
+		option.Formats(option.FormatName("thumb"), option.FormatWidth(50), option.FormatHeight(50)),
+	)
+
+	h := handler.NewHTTPUpload(&uploader.Image{Options: opts}, opts, imageProcessor)
+
+	post := func(files ...string) *httptest.ResponseRecorder {
+		body, contentType := multipartBody(t, files...)
+		req := httptest.NewRequest(http.MethodPost, "/upload", body)
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := post("normal.jpg"); rec.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP() code = %d, want %d (%s)", rec.Code, http.StatusOK, rec.Body)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job of the first upload not done")
+	}
+	stored := memStorage.Keys()
+
+	// The same file again, along with one failing
+	if rec := post("normal.jpg", "orientation_1.jpg"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("ServeHTTP() code = %d, want %d (%s)", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+
+	// The first upload and its formats are left alone
+	if keys := memStorage.Keys(); !reflect.DeepEqual(keys, stored) {
+		t.Errorf("storage holds %v, want %v", keys, stored)
+	}
+}
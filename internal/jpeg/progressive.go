@@ -0,0 +1,502 @@
+// Package jpeg writes progressive JPEGs, which neither image/jpeg nor imaging encode
+package jpeg
+
+import (
+	"bufio"
+	"errors"
+	"image"
+	"io"
+	"math"
+)
+
+// ErrSize is returned when an image is too large or empty to be written as JPEG
+var ErrSize = errors.New("jpeg: invalid image size")
+
+// DefaultQuality is the quality used by EncodeProgressive when quality is out of 1-100
+const DefaultQuality = 95
+
+// EncodeProgressive writes img as a progressive JPEG of quality 1-100 (4:2:0, standard Huffman tables).
+// Transparent areas are written as by image/jpeg, use flatten beforehand to get another background.
+func EncodeProgressive(w io.Writer, img image.Image, quality int) error {
+	b := img.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 || b.Dx() > 0xffff || b.Dy() > 0xffff {
+		return ErrSize
+	}
+	if quality < 1 || quality > 100 {
+		quality = DefaultQuality
+	}
+
+	var quant [2][64]int32
+	for i := range quant {
+		quant[i] = scaleQuant(unscaledQuant[i], quality)
+	}
+
+	planes := newPlanes(img)
+	e := &jpegWriter{w: bufio.NewWriter(w)}
+
+	e.marker(0xd8, nil)
+	e.marker(0xe0, []byte{'J', 'F', 'I', 'F', 0, 1, 1, 0, 0, 1, 0, 1, 0, 0})
+	for i, q := range quant {
+		body := []byte{byte(i)}
+		for _, v := range q {
+			body = append(body, byte(v))
+		}
+		e.marker(0xdb, body)
+	}
+	width, height := b.Dx(), b.Dy()
+	e.marker(0xc2, []byte{
+		8, byte(height >> 8), byte(height), byte(width >> 8), byte(width), 3,
+		1, 0x22, 0,
+		2, 0x11, 1,
+		3, 0x11, 1,
+	})
+	for i, spec := range huffmanSpecs {
+		body := []byte{byte(i>>1<<4 | i&1)}
+		body = append(body, spec.counts[:]...)
+		body = append(body, spec.values...)
+		e.marker(0xc4, body)
+	}
+
+	blocks := [3][][64]int32{}
+	for c := range blocks {
+		blocks[c] = planes.blocks(c, &quant[minInt(c, 1)])
+	}
+
+	e.dcScan(planes, blocks)
+	for _, scan := range acScans {
+		e.acScan(planes, blocks[scan.component], scan.component, scan.start, scan.end)
+	}
+
+	e.marker(0xd9, nil)
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+// acScans is the progression of AC coefficients by spectral selection, the DC of all components coming first
+var acScans = []struct {
+	component, start, end int
+}{
+	{0, 1, 5},
+	{2, 1, 63},
+	{1, 1, 63},
+	{0, 6, 63},
+}
+
+// zigzag maps the zig-zag index of coefficients to their natural index
+var zigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// unscaledQuant are the luminance and chrominance quantization tables of the JPEG spec (K.1), in zig-zag order
+var unscaledQuant = [2][64]int32{
+	{
+		16, 11, 12, 14, 12, 10, 16, 14,
+		13, 14, 18, 17, 16, 19, 24, 40,
+		26, 24, 22, 22, 24, 49, 35, 37,
+		29, 40, 58, 51, 61, 60, 57, 51,
+		56, 55, 64, 72, 92, 78, 64, 68,
+		87, 69, 55, 56, 80, 109, 81, 87,
+		95, 98, 103, 104, 103, 62, 77, 113,
+		121, 112, 100, 120, 92, 101, 103, 99,
+	},
+	{
+		17, 18, 18, 24, 21, 24, 47, 26,
+		26, 47, 99, 66, 56, 66, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+// scaleQuant scales a quantization table to quality as libjpeg does
+func scaleQuant(table [64]int32, quality int) [64]int32 {
+	scale := int32(200 - quality*2)
+	if quality < 50 {
+		scale = int32(5000 / quality)
+	}
+
+	for i, v := range table {
+		table[i] = clamp((v*scale+50)/100, 1, 255)
+	}
+	return table
+}
+
+// huffmanSpec is the number of codes of each length (1-16) then the values sorted by code
+type huffmanSpec struct {
+	counts [16]byte
+	values []byte
+}
+
+// huffmanSpecs are the luminance DC, chrominance DC, luminance AC and chrominance AC tables of the JPEG spec (K.3)
+var huffmanSpecs = [4]huffmanSpec{
+	{
+		[16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+		[]byte{
+			0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+			0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+			0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+			0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+			0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+			0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+			0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+			0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+			0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+			0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+			0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+			0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+			0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+			0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+			0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+			0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+			0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+			0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+			0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+	{
+		[16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+		[]byte{
+			0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+			0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+			0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+			0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+			0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+			0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+			0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+			0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+			0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+			0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+			0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+			0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+			0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+			0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+			0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+			0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+			0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+			0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+			0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+			0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+}
+
+// huffmanCode is the code of a value and its length in bits
+type huffmanCode struct {
+	code uint32
+	size uint8
+}
+
+// huffmanCodes are the codes of huffmanSpecs, indexed by value
+var huffmanCodes = func() (tables [4][256]huffmanCode) {
+	for i, spec := range huffmanSpecs {
+		code, k := uint32(0), 0
+		for size, n := range spec.counts {
+			for j := byte(0); j < n; j++ {
+				tables[i][spec.values[k]] = huffmanCode{code, uint8(size + 1)}
+				code++
+				k++
+			}
+			code <<= 1
+		}
+	}
+	return tables
+}()
+
+// planes are the Y, Cb and Cr samples of an image padded to whole MCUs, chroma subsampled 2x2
+type planes struct {
+	width, height int // Size of the image
+	mcuX, mcuY    int // Number of 16x16 MCUs
+	samples       [3][]uint8
+}
+
+// newPlanes converts img to YCbCr planes, repeating the edge pixels as padding
+func newPlanes(img image.Image) *planes {
+	b := img.Bounds()
+	p := &planes{width: b.Dx(), height: b.Dy()}
+	p.mcuX, p.mcuY = (p.width+15)/16, (p.height+15)/16
+
+	fw, fh := p.mcuX*16, p.mcuY*16
+	full := [3][]uint8{make([]uint8, fw*fh), make([]uint8, fw*fh), make([]uint8, fw*fh)}
+	for y := 0; y < fh; y++ {
+		sy := b.Min.Y + minInt(y, p.height-1)
+		for x := 0; x < fw; x++ {
+			if x >= p.width {
+				i := y*fw + x
+				full[0][i], full[1][i], full[2][i] = full[0][i-1], full[1][i-1], full[2][i-1]
+				continue
+			}
+			r, g, bl, _ := img.At(b.Min.X+x, sy).RGBA()
+			yy, cb, cr := rgbToYCbCr(uint8(r>>8), uint8(g>>8), uint8(bl>>8))
+			i := y*fw + x
+			full[0][i], full[1][i], full[2][i] = yy, cb, cr
+		}
+	}
+
+	p.samples[0] = full[0]
+	hw, hh := fw/2, fh/2
+	for c := 1; c < 3; c++ {
+		half := make([]uint8, hw*hh)
+		for y := 0; y < hh; y++ {
+			for x := 0; x < hw; x++ {
+				i := 2*y*fw + 2*x
+				sum := int(full[c][i]) + int(full[c][i+1]) + int(full[c][i+fw]) + int(full[c][i+fw+1])
+				half[y*hw+x] = uint8((sum + 2) / 4)
+			}
+		}
+		p.samples[c] = half
+	}
+	return p
+}
+
+// rgbToYCbCr converts a color as JFIF does
+func rgbToYCbCr(r, g, b uint8) (uint8, uint8, uint8) {
+	fr, fg, fb := float64(r), float64(g), float64(b)
+	y := 0.299*fr + 0.587*fg + 0.114*fb
+	cb := 128 - 0.168736*fr - 0.331264*fg + 0.5*fb
+	cr := 128 + 0.5*fr - 0.418688*fg - 0.081312*fb
+	return clampByte(y), clampByte(cb), clampByte(cr)
+}
+
+// clampByte rounds v to the nearest byte
+func clampByte(v float64) uint8 {
+	return uint8(clamp(math.Round(v), 0, 255))
+}
+
+// blocksWide returns the number of blocks per row allocated to component c
+func (p *planes) blocksWide(c int) int {
+	if c == 0 {
+		return p.mcuX * 2
+	}
+	return p.mcuX
+}
+
+// blocks returns the quantized DCT coefficients, in zig-zag order, of every block of component c in raster order
+func (p *planes) blocks(c int, quant *[64]int32) [][64]int32 {
+	wide := p.blocksWide(c)
+	high := p.mcuY
+	if c == 0 {
+		high *= 2
+	}
+	stride := wide * 8
+
+	blocks := make([][64]int32, wide*high)
+	var pixels [64]float64
+	for by := 0; by < high; by++ {
+		for bx := 0; bx < wide; bx++ {
+			for y := 0; y < 8; y++ {
+				row := p.samples[c][(by*8+y)*stride+bx*8:]
+				for x := 0; x < 8; x++ {
+					pixels[y*8+x] = float64(row[x]) - 128
+				}
+			}
+			coefs := fdct(&pixels)
+			block := &blocks[by*wide+bx]
+			for k, n := range zigzag {
+				block[k] = clamp(int32(math.Round(coefs[n]/float64(quant[k]))), -maxCoef, maxCoef)
+			}
+		}
+	}
+	return blocks
+}
+
+// maxCoef is the largest magnitude of coefficients coded by the standard Huffman tables
+const maxCoef = 1023
+
+// dctCos[u][x] is C(u)/2 * cos((2x+1)uπ/16)
+var dctCos = func() (t [8][8]float64) {
+	for u := 0; u < 8; u++ {
+		c := 0.5
+		if u == 0 {
+			c = 0.5 / math.Sqrt2
+		}
+		for x := 0; x < 8; x++ {
+			t[u][x] = c * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16)
+		}
+	}
+	return t
+}()
+
+// fdct returns the forward DCT of an 8x8 block of level shifted samples, in natural order
+func fdct(in *[64]float64) (out [64]float64) {
+	var tmp [64]float64
+	for y := 0; y < 8; y++ {
+		for u := 0; u < 8; u++ {
+			var s float64
+			for x := 0; x < 8; x++ {
+				s += dctCos[u][x] * in[y*8+x]
+			}
+			tmp[y*8+u] = s
+		}
+	}
+	for u := 0; u < 8; u++ {
+		for v := 0; v < 8; v++ {
+			var s float64
+			for y := 0; y < 8; y++ {
+				s += dctCos[v][y] * tmp[y*8+u]
+			}
+			out[v*8+u] = s
+		}
+	}
+	return out
+}
+
+// jpegWriter writes markers and entropy coded segments, keeping the first error
+type jpegWriter struct {
+	w     *bufio.Writer
+	err   error
+	bits  uint32
+	nBits uint8
+}
+
+// marker writes a marker, with its length when body is not nil
+func (e *jpegWriter) marker(m byte, body []byte) {
+	if e.err != nil {
+		return
+	}
+	header := []byte{0xff, m}
+	if body != nil {
+		n := len(body) + 2
+		header = append(header, byte(n>>8), byte(n))
+	}
+	if _, e.err = e.w.Write(header); e.err == nil {
+		_, e.err = e.w.Write(body)
+	}
+}
+
+// emit writes the size low bits of bits, stuffing a zero after 0xff bytes
+func (e *jpegWriter) emit(bits uint32, size uint8) {
+	if e.err != nil || size == 0 {
+		return
+	}
+	e.bits = e.bits<<size | bits&(1<<size-1)
+	e.nBits += size
+	for e.nBits >= 8 {
+		b := byte(e.bits >> (e.nBits - 8))
+		e.nBits -= 8
+		if e.err = e.w.WriteByte(b); e.err == nil && b == 0xff {
+			e.err = e.w.WriteByte(0)
+		}
+	}
+}
+
+// flush pads the last byte of a scan with 1 bits
+func (e *jpegWriter) flush() {
+	if e.nBits > 0 {
+		e.emit(1<<(8-e.nBits)-1, 8-e.nBits)
+	}
+	e.bits, e.nBits = 0, 0
+}
+
+// emitValue writes the Huffman code of symbol (run<<4 | category of v) then the bits of v
+func (e *jpegWriter) emitValue(table int, run int, v int32) {
+	a, bits := v, v
+	if a < 0 {
+		a, bits = -v, v-1
+	}
+	size := uint8(0)
+	for ; a > 0; a >>= 1 {
+		size++
+	}
+	h := huffmanCodes[table][byte(run)<<4|size]
+	e.emit(h.code, h.size)
+	e.emit(uint32(bits), size)
+}
+
+// dcScan writes the DC coefficients of all the components interleaved by MCU
+func (e *jpegWriter) dcScan(p *planes, blocks [3][][64]int32) {
+	e.marker(0xda, []byte{3, 1, 0x00, 2, 0x11, 3, 0x11, 0, 0, 0})
+
+	var pred [3]int32
+	for my := 0; my < p.mcuY; my++ {
+		for mx := 0; mx < p.mcuX; mx++ {
+			for i := 0; i < 4; i++ {
+				dc := blocks[0][(my*2+i/2)*p.blocksWide(0)+mx*2+i%2][0]
+				e.emitValue(0, 0, dc-pred[0])
+				pred[0] = dc
+			}
+			for c := 1; c < 3; c++ {
+				dc := blocks[c][my*p.blocksWide(c)+mx][0]
+				e.emitValue(1, 0, dc-pred[c])
+				pred[c] = dc
+			}
+		}
+	}
+	e.flush()
+}
+
+// acScan writes the AC coefficients start to end of component c, block by block over the area of the image only
+func (e *jpegWriter) acScan(p *planes, blocks [][64]int32, c, start, end int) {
+	table := 2 + minInt(c, 1)
+	e.marker(0xda, []byte{1, byte(c + 1), byte(minInt(c, 1)), byte(start), byte(end), 0})
+
+	width, height := p.width, p.height
+	if c > 0 {
+		width, height = (width+1)/2, (height+1)/2
+	}
+	wide := p.blocksWide(c)
+	for by := 0; by < (height+7)/8; by++ {
+		for bx := 0; bx < (width+7)/8; bx++ {
+			block := &blocks[by*wide+bx]
+			run := 0
+			for k := start; k <= end; k++ {
+				if block[k] == 0 {
+					run++
+					continue
+				}
+				for ; run > 15; run -= 16 {
+					h := huffmanCodes[table][0xf0]
+					e.emit(h.code, h.size)
+				}
+				e.emitValue(table, run, block[k])
+				run = 0
+			}
+			if run > 0 {
+				h := huffmanCodes[table][0x00]
+				e.emit(h.code, h.size)
+			}
+		}
+	}
+	e.flush()
+}
+
+// minInt returns the smaller of a and b
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// clamp returns v bounded by lo and hi
+func clamp[T int | int32 | float64](v, lo, hi T) T {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
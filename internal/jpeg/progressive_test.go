@@ -0,0 +1,107 @@
+package jpeg_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	stdjpeg "image/jpeg"
+	"math"
+	"testing"
+
+	"go.lsl.digital/lardwaz/upload/internal/jpeg"
+)
+
+func TestEncodeProgressive(t *testing.T) {
+	tests := []struct {
+		name    string
+		width   int
+		height  int
+		quality int
+		wantErr error
+	}{
+		{"single_pixel", 1, 1, 90, nil},
+		{"partial_mcus", 17, 9, 90, nil},
+		{"whole_mcus", 64, 48, 75, nil},
+		{"odd_size", 333, 201, 90, nil},
+		{"lowest_quality", 64, 48, 1, nil},
+		{"highest_quality", 64, 48, 100, nil},
+		{"default_quality", 64, 48, 0, nil},
+		{"empty", 0, 10, 90, jpeg.ErrSize},
+		{"too_wide", 70000, 1, 90, jpeg.ErrSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := gradient(tt.width, tt.height)
+
+			var out bytes.Buffer
+			err := jpeg.EncodeProgressive(&out, src, tt.quality)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("EncodeProgressive() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if !bytes.Contains(out.Bytes(), []byte{0xff, 0xc2}) {
+				t.Errorf("SOF2 marker not found")
+			}
+
+			img, err := stdjpeg.Decode(&out)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if img.Bounds() != src.Bounds() {
+				t.Fatalf("Decode() bounds = %v, want %v", img.Bounds(), src.Bounds())
+			}
+
+			// As close to the source as the baseline encoder of the same quality
+			var baseline bytes.Buffer
+			quality := tt.quality
+			if quality == 0 {
+				quality = jpeg.DefaultQuality
+			}
+			if err := stdjpeg.Encode(&baseline, src, &stdjpeg.Options{Quality: quality}); err != nil {
+				t.Fatal(err)
+			}
+			want, err := stdjpeg.Decode(&baseline)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := psnr(src, img), psnr(src, want); got < want-0.5 {
+				t.Errorf("PSNR = %.2f dB, want at least %.2f dB", got, want-0.5)
+			}
+		})
+	}
+}
+
+// gradient returns an opaque image whose colors vary on both axes
+func gradient(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 3), uint8(y * 5), uint8((x + y) * 2), 255})
+		}
+	}
+	return img
+}
+
+// psnr returns the peak signal to noise ratio of img compared to src, in dB
+func psnr(src, img image.Image) float64 {
+	var sum float64
+	b := src.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r1, g1, b1, _ := src.At(x, y).RGBA()
+			r2, g2, b2, _ := img.At(x, y).RGBA()
+			for _, d := range []float64{float64(r1>>8) - float64(r2>>8), float64(g1>>8) - float64(g2>>8), float64(b1>>8) - float64(b2>>8)} {
+				sum += d * d
+			}
+		}
+	}
+	mse := sum / float64(3*b.Dx()*b.Dy())
+	if mse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/mse)
+}
@@ -1,10 +1,79 @@
 package upload
 
-// Job represents current file being processed
+import (
+	"context"
+	"time"
+)
+
+// Job represents current file being processed.
+// Done and Failed channels are closed on completion so that any number of waiters observe it.
 type Job interface {
 	File() Uploaded
+	// Done is closed once the job succeeded
 	Done() <-chan struct{}
 	SetDone()
-	Failed() <-chan error
+	// Failed is closed once the job failed, Err returning the error: <-j.Failed(); err := j.Err()
+	Failed() <-chan struct{}
 	SetFailed(error)
+	// Err returns the error the job failed with
+	Err() error
+	State() JobState
+	SetRunning()
+	AddFormat(FormatResult)
+	Result() JobResult
+	// Wait waits for the job to complete and returns its result along with the error it failed with
+	Wait(ctx context.Context) (JobResult, error)
+}
+
+// JobState represents the state of a Job
+type JobState int
+
+// Job states
+const (
+	JobQueued JobState = iota
+	JobRunning
+	JobSucceeded
+	JobPartiallyFailed
+	JobFailed
+)
+
+func (s JobState) String() string {
+	switch s {
+	case JobQueued:
+		return "queued"
+	case JobRunning:
+		return "running"
+	case JobSucceeded:
+		return "succeeded"
+	case JobPartiallyFailed:
+		return "partially-failed"
+	case JobFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// JobResult represents the outcome of a Job
+type JobResult struct {
+	State     JobState
+	QueuedAt  time.Time
+	StartedAt time.Time
+	EndedAt   time.Time
+	Formats   []FormatResult
+}
+
+// FormatResult represents the outcome of a format generated by a Job
+type FormatResult struct {
+	Name   string
+	Path   string
+	URL    string
+	Width  int
+	Height int
+	Size   int64
+	Err    error
+	// Attempts is the number of times generating the format was tried
+	Attempts int
+	// Source is the name of the format it was resized from, empty for the original
+	Source string
 }
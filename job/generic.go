@@ -1,44 +1,159 @@
 package job
 
-import "go.lsl.digital/lardwaz/upload"
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.lsl.digital/lardwaz/upload"
+)
 
 // Generic represents current image file being processed
 type Generic struct {
 	file   upload.Uploaded
 	done   chan struct{}
-	failed chan error
+	failed chan struct{}
+
+	// finished is closed once the job completes, either done or failed
+	finished chan struct{}
+	once     sync.Once
+
+	mu     sync.Mutex
+	result upload.JobResult
+	err    error
 }
 
 // NewGeneric returns a new Generic
 func NewGeneric(file upload.Uploaded) *Generic {
 	return &Generic{
-		file:   file,
-		done:   make(chan struct{}),
-		failed: make(chan error),
+		file:     file,
+		done:     make(chan struct{}),
+		failed:   make(chan struct{}),
+		finished: make(chan struct{}),
+		result: upload.JobResult{
+			State:    upload.JobQueued,
+			QueuedAt: time.Now(),
+		},
 	}
 }
 
 // File returns the file upload.Uploaded
-func (j Generic) File() upload.Uploaded {
+func (j *Generic) File() upload.Uploaded {
 	return j.file
 }
 
 // Done returns a channel indicating if job is done
-func (j Generic) Done() <-chan struct{} {
+func (j *Generic) Done() <-chan struct{} {
 	return j.done
 }
 
-// SetDone sets the job as completed
+// SetDone sets the job as completed, unless it already completed
 func (j *Generic) SetDone() {
-	j.done <- struct{}{}
+	j.once.Do(func() {
+		j.finish(nil)
+		close(j.done)
+	})
 }
 
-// Failed returns a channel indicating if job has failed
-func (j Generic) Failed() <-chan error {
+// Failed returns a channel closed once job has failed
+func (j *Generic) Failed() <-chan struct{} {
 	return j.failed
 }
 
-// SetFailed sets the job as failed
+// SetFailed sets the job as failed, partially if some formats were generated, unless it already completed
 func (j *Generic) SetFailed(err error) {
-	j.failed <- err
+	j.once.Do(func() {
+		j.finish(err)
+		close(j.failed)
+	})
+}
+
+// Err returns the error the job failed with
+func (j *Generic) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.err
+}
+
+// State returns the current state of the job
+func (j *Generic) State() upload.JobState {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.result.State
+}
+
+// SetRunning sets the job as started
+func (j *Generic) SetRunning() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.result.State = upload.JobRunning
+	j.result.StartedAt = time.Now()
+}
+
+// AddFormat adds the result of a generated format
+func (j *Generic) AddFormat(format upload.FormatResult) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.result.Formats = append(j.result.Formats, format)
+}
+
+// Result returns the current result of the job
+func (j *Generic) Result() upload.JobResult {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	result := j.result
+	result.Formats = append([]upload.FormatResult(nil), j.result.Formats...)
+
+	return result
+}
+
+// Wait waits for the job to complete or ctx to be done
+func (j *Generic) Wait(ctx context.Context) (upload.JobResult, error) {
+	select {
+	case <-j.finished:
+	case <-ctx.Done():
+		return j.Result(), ctx.Err()
+	}
+
+	return j.Result(), j.Err()
+}
+
+// finish records the end of the job
+func (j *Generic) finish(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.err = err
+	j.result.EndedAt = time.Now()
+	if j.result.StartedAt.IsZero() {
+		j.result.StartedAt = j.result.EndedAt
+	}
+
+	switch {
+	case err == nil:
+		j.result.State = upload.JobSucceeded
+	case succeeded(j.result.Formats) > 0:
+		j.result.State = upload.JobPartiallyFailed
+	default:
+		j.result.State = upload.JobFailed
+	}
+
+	close(j.finished)
+}
+
+// succeeded returns the number of formats generated without error
+func succeeded(formats []upload.FormatResult) int {
+	n := 0
+	for _, format := range formats {
+		if format.Err == nil {
+			n++
+		}
+	}
+
+	return n
 }
@@ -0,0 +1,143 @@
+package job_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/file"
+	"go.lsl.digital/lardwaz/upload/job"
+	"go.lsl.digital/lardwaz/upload/option"
+	"go.lsl.digital/lardwaz/upload/processor"
+	"go.lsl.digital/lardwaz/upload/storage"
+)
+
+func TestGenericState(t *testing.T) {
+	failure := errors.New("failure")
+
+	tests := []struct {
+		name    string
+		formats []upload.FormatResult
+		err     error
+		want    upload.JobState
+	}{
+		{"succeeded", []upload.FormatResult{{Name: "thumb"}}, nil, upload.JobSucceeded},
+		{"partially failed", []upload.FormatResult{{Name: "thumb"}, {Name: "large", Err: failure}}, failure, upload.JobPartiallyFailed},
+		{"failed", []upload.FormatResult{{Name: "large", Err: failure}}, failure, upload.JobFailed},
+		{"failed without formats", nil, failure, upload.JobFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := job.NewGeneric(nil)
+			if got := j.State(); got != upload.JobQueued {
+				t.Errorf("State() = %v, want %v", got, upload.JobQueued)
+			}
+
+			j.SetRunning()
+			if got := j.State(); got != upload.JobRunning {
+				t.Errorf("State() = %v, want %v", got, upload.JobRunning)
+			}
+
+			for _, format := range tt.formats {
+				j.AddFormat(format)
+			}
+
+			if tt.err != nil {
+				j.SetFailed(tt.err)
+			} else {
+				j.SetDone()
+			}
+
+			select {
+			case <-j.Done():
+			case <-j.Failed():
+			case <-time.After(time.Second):
+				t.Fatal("job not completed")
+			}
+
+			result, err := j.Wait(context.Background())
+			if err != tt.err {
+				t.Errorf("Wait() error = %v, want %v", err, tt.err)
+			}
+			if result.State != tt.want {
+				t.Errorf("Wait() state = %v, want %v", result.State, tt.want)
+			}
+			if len(result.Formats) != len(tt.formats) {
+				t.Errorf("Wait() formats = %d, want %d", len(result.Formats), len(tt.formats))
+			}
+			if result.StartedAt.IsZero() || result.EndedAt.Before(result.StartedAt) {
+				t.Errorf("Wait() timestamps = %v - %v", result.StartedAt, result.EndedAt)
+			}
+		})
+	}
+}
+
+func TestGenericWaitContext(t *testing.T) {
+	j := job.NewGeneric(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	result, err := j.Wait(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Wait() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if result.State != upload.JobQueued {
+		t.Errorf("Wait() state = %v, want %v", result.State, upload.JobQueued)
+	}
+}
+
+func TestGenericCloseOnce(t *testing.T) {
+	j := job.NewGeneric(nil)
+	j.SetFailed(errors.New("first"))
+
+	// Later completions are ignored
+	j.SetDone()
+	j.SetFailed(errors.New("second"))
+
+	// Any number of waiters, including late ones, observe completion
+	for i := 0; i < 3; i++ {
+		select {
+		case <-j.Failed():
+		case <-j.Done():
+			t.Fatal("job should not be done")
+		default:
+			t.Fatal("job should have failed")
+		}
+	}
+
+	if err := j.Err(); err == nil || err.Error() != "first" {
+		t.Errorf("Err() = %v, want %v", err, "first")
+	}
+}
+
+func TestGenericNoLeak(t *testing.T) {
+	memStorage := storage.NewMemory()
+	uploaded := file.NewMockGeneric("normal.jpg", option.Dir("../testdata"), option.Storage(memStorage))
+	if err := memStorage.Put(uploaded.DiskPath(), bytes.NewReader(uploaded.Content())); err != nil {
+		t.Fatal(err)
+	}
+
+	p := processor.NewImage(option.Formats(option.FormatName("thumb"), option.FormatWidth(50), option.FormatHeight(50)))
+
+	before := runtime.NumGoroutine()
+
+	// Nobody listens to these jobs
+	for i := 0; i < 10; i++ {
+		if _, err := p.Process(uploaded, true); err != nil {
+			t.Fatalf("Process() error = %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines = %d, want %d: processing goroutines leaked", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,98 @@
+package upload
+
+import "time"
+
+// MetadataKind is a kind of metadata embedded in image files
+type MetadataKind int
+
+// Kinds of metadata
+const (
+	// MetadataEXIF holds camera settings, serial numbers, capture time and GPS coordinates
+	MetadataEXIF MetadataKind = iota
+	// MetadataXMP is Adobe XMP
+	MetadataXMP
+	// MetadataICC is a color profile
+	MetadataICC
+	// MetadataIPTC holds captions, keywords and copyright (Photoshop resources)
+	MetadataIPTC
+	// MetadataText is comments and textual data
+	MetadataText
+	// MetadataOther is any other metadata: timestamps, unknown segments, data after the image
+	MetadataOther
+)
+
+// String returns the name of k
+func (k MetadataKind) String() string {
+	switch k {
+	case MetadataEXIF:
+		return "exif"
+	case MetadataXMP:
+		return "xmp"
+	case MetadataICC:
+		return "icc"
+	case MetadataIPTC:
+		return "iptc"
+	case MetadataText:
+		return "text"
+	case MetadataOther:
+		return "other"
+	default:
+		return "unknown"
+	}
+}
+
+// MetadataSegment is a metadata segment of an image file
+type MetadataSegment struct {
+	Kind MetadataKind
+	// Name is the name of the segment in its container (e.g APP1, eXIf or EXIF)
+	Name string
+	// Size is the size of the segment in bytes, headers included
+	Size int
+}
+
+// MetadataStripped represents an uploaded file whose metadata was stripped before it was saved
+type MetadataStripped interface {
+	// RemovedMetadata returns the metadata segments removed from the file
+	RemovedMetadata() []MetadataSegment
+}
+
+// Metadata is the metadata of an image, fields being zero when unknown
+type Metadata struct {
+	// Width and Height are the dimensions of the image once upright
+	Width  int
+	Height int
+	// Orientation is the EXIF orientation (1-8) of the file as saved, 1 once converted as it is written upright
+	Orientation int
+	// CaptureTime is in the time zone recorded by the camera, UTC if none
+	CaptureTime time.Time
+	Make        string
+	Model       string
+	Lens        string
+	Exposure    Exposure
+	// GPS is nil if the location is unknown
+	GPS       *GPS
+	Caption   string
+	Keywords  []string
+	Copyright string
+}
+
+// Exposure is the settings of the camera at capture time
+type Exposure struct {
+	Time        time.Duration
+	FNumber     float64
+	ISO         int
+	FocalLength float64 // In millimeters
+}
+
+// GPS is the location of the camera at capture time
+type GPS struct {
+	Latitude  float64 // In degrees, negative in the southern hemisphere
+	Longitude float64 // In degrees, negative west of Greenwich
+	Altitude  float64 // In meters, negative below sea level
+}
+
+// MetadataExtracted represents an uploaded file whose metadata was extracted before it was saved
+type MetadataExtracted interface {
+	// Metadata returns the metadata of the file as uploaded, nil if it could not be read
+	Metadata() *Metadata
+}
@@ -0,0 +1,136 @@
+package metadata
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"  // Dimensions of GIF images
+	_ "image/jpeg" // Dimensions of JPEG images
+	_ "image/png"  // Dimensions of PNG images
+	"math"
+	"time"
+
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/exif"
+	_ "golang.org/x/image/webp" // Dimensions of WebP images
+)
+
+// Extract returns the dimensions, EXIF and IPTC metadata of an image.
+// Images without metadata only get their dimensions and orientation 1.
+func Extract(content []byte) (*upload.Metadata, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", upload.ErrInvalidImage, err)
+	}
+
+	m := &upload.Metadata{Width: config.Width, Height: config.Height, Orientation: 1}
+
+	if x, err := exif.Decode(content); err == nil {
+		readExif(m, x)
+	}
+	if m.Orientation >= 5 {
+		m.Width, m.Height = m.Height, m.Width
+	}
+
+	if iptc, err := iptcRecords(content); err == nil {
+		m.Caption = iptc.get(iptcCaption)
+		m.Keywords = iptc[iptcKeywords]
+		m.Copyright = iptc.get(iptcCopyright)
+	}
+
+	return m, nil
+}
+
+// readExif sets the fields of m read from x
+func readExif(m *upload.Metadata, x *exif.Exif) {
+	if v, ok := x.Uint(exif.IFD0, exif.TagOrientation); ok && v >= 1 && v <= 8 {
+		m.Orientation = int(v)
+	}
+	m.Make, _ = x.String(exif.IFD0, exif.TagMake)
+	m.Model, _ = x.String(exif.IFD0, exif.TagModel)
+	m.Lens, _ = x.String(exif.IFDExif, exif.TagLensModel)
+	m.CaptureTime = captureTime(x)
+
+	if v, ok := x.Rationals(exif.IFDExif, exif.TagExposureTime); ok {
+		m.Exposure.Time = time.Duration(math.Round(v[0] * float64(time.Second)))
+	}
+	if v, ok := x.Rationals(exif.IFDExif, exif.TagFNumber); ok {
+		m.Exposure.FNumber = v[0]
+	}
+	if v, ok := x.Uint(exif.IFDExif, exif.TagISO); ok {
+		m.Exposure.ISO = int(v)
+	}
+	if v, ok := x.Rationals(exif.IFDExif, exif.TagFocalLength); ok {
+		m.Exposure.FocalLength = v[0]
+	}
+
+	m.GPS = gps(x)
+}
+
+// exifTimeLayout is the layout of EXIF dates
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// captureTime returns the date the image was taken, digitized or last modified, in that order
+func captureTime(x *exif.Exif) time.Time {
+	dates := []struct {
+		ifd          exif.IFD
+		date, offset uint16
+	}{
+		{exif.IFDExif, exif.TagDateTimeOriginal, exif.TagOffsetTimeOriginal},
+		{exif.IFDExif, exif.TagDateTimeDigitized, exif.TagOffsetTimeDigitized},
+		{exif.IFD0, exif.TagDateTime, exif.TagOffsetTime},
+	}
+	for _, d := range dates {
+		date, ok := x.String(d.ifd, d.date)
+		if !ok {
+			continue
+		}
+
+		loc := time.UTC
+		if offset, ok := x.String(exif.IFDExif, d.offset); ok {
+			if t, err := time.Parse("-07:00", offset); err == nil {
+				loc = t.Location()
+			}
+		}
+
+		if t, err := time.ParseInLocation(exifTimeLayout, date, loc); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// gps returns the location of x, nil if it has no latitude and longitude
+func gps(x *exif.Exif) *upload.GPS {
+	lat, ok := degrees(x, exif.TagGPSLatitude, exif.TagGPSLatitudeRef, "S")
+	if !ok {
+		return nil
+	}
+	lon, ok := degrees(x, exif.TagGPSLongitude, exif.TagGPSLongitudeRef, "W")
+	if !ok {
+		return nil
+	}
+
+	g := &upload.GPS{Latitude: lat, Longitude: lon}
+	if alt, ok := x.Rationals(exif.IFDGPS, exif.TagGPSAltitude); ok {
+		g.Altitude = alt[0]
+		if ref, ok := x.Uint(exif.IFDGPS, exif.TagGPSAltitudeRef); ok && ref == 1 {
+			g.Altitude = -g.Altitude
+		}
+	}
+	return g
+}
+
+// degrees returns the decimal degrees of a degrees, minutes, seconds GPS tag, negative when its ref is negative
+func degrees(x *exif.Exif, tag, refTag uint16, negative string) (float64, bool) {
+	dms, ok := x.Rationals(exif.IFDGPS, tag)
+	if !ok || len(dms) != 3 {
+		return 0, false
+	}
+
+	v := dms[0] + dms[1]/60 + dms[2]/3600
+	if ref, _ := x.String(exif.IFDGPS, refTag); ref == negative {
+		v = -v
+	}
+	return v, true
+}
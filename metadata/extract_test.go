@@ -0,0 +1,116 @@
+package metadata_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/metadata"
+)
+
+func TestExtract(t *testing.T) {
+	captured := time.Date(2026, 5, 17, 14, 32, 10, 0, time.FixedZone("", 4*60*60))
+	exposure := upload.Exposure{Time: 4 * time.Millisecond, FNumber: 2.8, ISO: 400, FocalLength: 50}
+	gps := &upload.GPS{Latitude: -20.16, Longitude: 57.505, Altitude: 125}
+
+	tests := []struct {
+		name string
+		file string
+		want *upload.Metadata
+	}{
+		{
+			"jpeg", "metadata.jpg",
+			&upload.Metadata{
+				Width: 399, Height: 463, Orientation: 6, CaptureTime: captured,
+				Make: "Canon", Model: "Canon EOS 5D Mark IV", Lens: "EF50mm f/1.8 STM", Exposure: exposure, GPS: gps,
+				Caption: "Sunset over Le Morne", Keywords: []string{"sunset", "beach", "Mauritius"}, Copyright: "© 2026 Jane Doe",
+			},
+		},
+		{
+			"png", "metadata.png",
+			&upload.Metadata{
+				Width: 360, Height: 640, Orientation: 6, CaptureTime: captured,
+				Make: "Canon", Model: "Canon EOS 5D Mark IV", Lens: "EF50mm f/1.8 STM", Exposure: exposure, GPS: gps,
+			},
+		},
+		{
+			"webp", "metadata.webp",
+			&upload.Metadata{
+				Width: 360, Height: 640, Orientation: 6, CaptureTime: captured,
+				Make: "Canon", Model: "Canon EOS 5D Mark IV", Lens: "EF50mm f/1.8 STM", Exposure: exposure, GPS: gps,
+			},
+		},
+		{
+			"orientation_only", "orientation_6.jpg",
+			&upload.Metadata{Width: 160, Height: 80, Orientation: 6}, // Stored transposed
+		},
+		{
+			"without_metadata", "normal.jpg",
+			&upload.Metadata{Width: 463, Height: 399, Orientation: 1},
+		},
+		{
+			"gif", "normal.gif",
+			&upload.Metadata{Width: 400, Height: 400, Orientation: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := ioutil.ReadFile(filepath.Join(testDataFolder, tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := metadata.Extract(content)
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+
+			// Compared apart, as times and floats are not comparable as is
+			if !got.CaptureTime.Equal(tt.want.CaptureTime) {
+				t.Errorf("Extract() CaptureTime = %v, want %v", got.CaptureTime, tt.want.CaptureTime)
+			}
+			if _, offset := got.CaptureTime.Zone(); !tt.want.CaptureTime.IsZero() && offset != 4*60*60 {
+				t.Errorf("Extract() CaptureTime offset = %d, want %d", offset, 4*60*60)
+			}
+			if !equalGPS(got.GPS, tt.want.GPS) {
+				t.Errorf("Extract() GPS = %+v, want %+v", got.GPS, tt.want.GPS)
+			}
+			if math.Abs(got.Exposure.FNumber-tt.want.Exposure.FNumber) > 1e-9 {
+				t.Errorf("Extract() FNumber = %v, want %v", got.Exposure.FNumber, tt.want.Exposure.FNumber)
+			}
+
+			gotRest, wantRest := *got, *tt.want
+			gotRest.CaptureTime, wantRest.CaptureTime = time.Time{}, time.Time{}
+			gotRest.GPS, wantRest.GPS = nil, nil
+			gotRest.Exposure.FNumber, wantRest.Exposure.FNumber = 0, 0
+			if !reflect.DeepEqual(gotRest, wantRest) {
+				t.Errorf("Extract() = %+v, want %+v", gotRest, wantRest)
+			}
+		})
+	}
+}
+
+func TestExtractInvalid(t *testing.T) {
+	content, err := ioutil.ReadFile(filepath.Join(testDataFolder, "normal.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := metadata.Extract(content); !errors.Is(err, upload.ErrInvalidImage) {
+		t.Errorf("Extract() error = %v, want %v", err, upload.ErrInvalidImage)
+	}
+}
+
+// equalGPS reports whether two locations are the same to a millimeter
+func equalGPS(a, b *upload.GPS) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	const epsilon = 1e-8
+	return math.Abs(a.Latitude-b.Latitude) < epsilon && math.Abs(a.Longitude-b.Longitude) < epsilon && math.Abs(a.Altitude-b.Altitude) < 1e-3
+}
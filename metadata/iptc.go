@@ -0,0 +1,154 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unicode/utf8"
+)
+
+// IPTC datasets of the application record
+const (
+	iptcKeywords  = 25
+	iptcCopyright = 116
+	iptcCaption   = 120
+)
+
+// iptcResource is the Photoshop image resource holding the IPTC records
+const iptcResource = 0x0404
+
+// utf8Charset is the value of the coded character set dataset declaring UTF-8
+var utf8Charset = []byte("\x1b%G")
+
+// iptc are the values of the IPTC application record by dataset
+type iptc map[byte][]string
+
+// get returns the first value of dataset
+func (r iptc) get(dataset byte) string {
+	if values := r[dataset]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// iptcRecords returns the IPTC application record of a JPEG
+func iptcRecords(content []byte) (iptc, error) {
+	data, err := jpegPhotoshop(content)
+	if err != nil {
+		return nil, err
+	}
+
+	resource, err := photoshopResource(data, iptcResource)
+	if err != nil {
+		return nil, err
+	}
+
+	records := iptc{}
+	isUTF8 := false
+	for i := 0; i+5 <= len(resource); {
+		if resource[i] != 0x1c {
+			return nil, ErrMalformed
+		}
+		record, dataset := resource[i+1], resource[i+2]
+		size := int(binary.BigEndian.Uint16(resource[i+3:]))
+		if size&0x8000 != 0 {
+			// Extended datasets only hold binary data
+			return records, nil
+		}
+
+		end := i + 5 + size
+		if end > len(resource) {
+			return nil, ErrMalformed
+		}
+		value := resource[i+5 : end]
+
+		switch record {
+		case 1:
+			if dataset == 90 {
+				isUTF8 = bytes.Equal(value, utf8Charset)
+			}
+		case 2:
+			records[dataset] = append(records[dataset], iptcString(value, isUTF8))
+		}
+		i = end
+	}
+	return records, nil
+}
+
+// iptcString returns value decoded as UTF-8 or, when it is not valid UTF-8, Latin-1
+func iptcString(value []byte, isUTF8 bool) string {
+	if isUTF8 || utf8.Valid(value) {
+		return string(value)
+	}
+
+	runes := make([]rune, len(value))
+	for i, b := range value {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// jpegPhotoshop returns the image resources of the Photoshop APP13 segment of a JPEG
+func jpegPhotoshop(content []byte) ([]byte, error) {
+	if !bytes.HasPrefix(content, []byte{0xff, 0xd8}) {
+		return nil, ErrMalformed
+	}
+
+	for i := 2; i+4 <= len(content); {
+		if content[i] != 0xff {
+			return nil, ErrMalformed
+		}
+		marker := content[i+1]
+		switch {
+		case marker == 0xff:
+			// Fill byte
+			i++
+			continue
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7):
+			// Standalone markers
+			i += 2
+			continue
+		case marker == 0xda || marker == 0xd9:
+			// Metadata precedes the image data
+			return nil, ErrMalformed
+		}
+
+		end := i + 2 + int(binary.BigEndian.Uint16(content[i+2:]))
+		if end > len(content) || end < i+4 {
+			return nil, ErrMalformed
+		}
+		if data := content[i+4 : end]; marker == 0xed && bytes.HasPrefix(data, photoshopHeader) {
+			return data[len(photoshopHeader):], nil
+		}
+		i = end
+	}
+	return nil, ErrMalformed
+}
+
+// photoshopResource returns the data of the Photoshop image resource id
+func photoshopResource(data []byte, id uint16) ([]byte, error) {
+	for i := 0; i+7 <= len(data); {
+		if string(data[i:i+4]) != "8BIM" {
+			return nil, ErrMalformed
+		}
+		resource := binary.BigEndian.Uint16(data[i+4:])
+
+		// The name is a Pascal string padded to an even length
+		i += 6
+		name := 1 + int(data[i])
+		i += name + name%2
+		if i+4 > len(data) {
+			return nil, ErrMalformed
+		}
+
+		size := int(binary.BigEndian.Uint32(data[i:]))
+		i += 4
+		if size < 0 || i+size > len(data) {
+			return nil, ErrMalformed
+		}
+		if resource == id {
+			return data[i : i+size], nil
+		}
+		i += size + size%2
+	}
+	return nil, ErrMalformed
+}
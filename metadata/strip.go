@@ -0,0 +1,356 @@
+// Package metadata reads and removes the metadata of JPEG, PNG and WebP images
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/exif"
+)
+
+// ErrMalformed is returned when the container of an image cannot be parsed
+var ErrMalformed = errors.New("metadata: malformed image")
+
+// Strip returns content without its metadata, but the kinds of keep, and the removed segments.
+// Pixels are not recompressed. Content of other types than JPEG, PNG and WebP is returned as is.
+// The orientation of images whose EXIF is removed is kept in a minimal EXIF segment.
+func Strip(content []byte, keep ...upload.MetadataKind) ([]byte, []upload.MetadataSegment, error) {
+	s := stripper{keep: keep, orientation: exif.Orientation(content)}
+
+	switch {
+	case bytes.HasPrefix(content, []byte{0xff, 0xd8}):
+		return s.jpeg(content)
+	case bytes.HasPrefix(content, pngSignature):
+		return s.png(content)
+	case isWebP(content):
+		return s.webp(content)
+	default:
+		return content, nil, nil
+	}
+}
+
+// stripper removes the metadata of an image
+type stripper struct {
+	keep        []upload.MetadataKind
+	orientation int // Orientation kept when EXIF is removed
+	removed     []upload.MetadataSegment
+	exifRemoved bool
+}
+
+// remove checks if a segment of kind is removed, reporting it if so
+func (s *stripper) remove(kind upload.MetadataKind, name string, size int) bool {
+	for _, k := range s.keep {
+		if k == kind {
+			return false
+		}
+	}
+
+	s.removed = append(s.removed, upload.MetadataSegment{Kind: kind, Name: name, Size: size})
+	if kind == upload.MetadataEXIF {
+		s.exifRemoved = true
+	}
+	return true
+}
+
+// orientationTIFF returns the TIFF structure of an EXIF holding only the orientation, nil if it is not needed
+func (s *stripper) orientationTIFF() []byte {
+	if !s.exifRemoved || s.orientation <= 1 {
+		return nil
+	}
+
+	b := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1}
+	b = binary.BigEndian.AppendUint16(b, exif.TagOrientation)
+	b = append(b, 0, 3, 0, 0, 0, 1)
+	b = binary.BigEndian.AppendUint16(b, uint16(s.orientation))
+	return append(b, 0, 0, 0, 0, 0, 0)
+}
+
+// exifHeader prefixes the TIFF structure in JPEG APP1 segments
+var exifHeader = []byte("Exif\x00\x00")
+
+// JPEG segments by their signature
+var (
+	xmpHeader         = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpExtendedHeader = []byte("http://ns.adobe.com/xmp/extension/\x00")
+	iccHeader         = []byte("ICC_PROFILE\x00")
+	photoshopHeader   = []byte("Photoshop 3.0\x00")
+)
+
+// jpegKind returns the kind of metadata of a JPEG segment, false if it is not metadata
+func jpegKind(marker byte, data []byte) (upload.MetadataKind, bool) {
+	switch {
+	case marker == 0xe0, marker == 0xee:
+		// JFIF and Adobe segments are needed to decode colors
+		return 0, false
+	case marker == 0xfe:
+		return upload.MetadataText, true
+	case marker == 0xe1 && bytes.HasPrefix(data, exifHeader):
+		return upload.MetadataEXIF, true
+	case marker == 0xe1 && (bytes.HasPrefix(data, xmpHeader) || bytes.HasPrefix(data, xmpExtendedHeader)):
+		return upload.MetadataXMP, true
+	case marker == 0xe2 && bytes.HasPrefix(data, iccHeader):
+		return upload.MetadataICC, true
+	case marker == 0xed && bytes.HasPrefix(data, photoshopHeader):
+		return upload.MetadataIPTC, true
+	case marker >= 0xe1 && marker <= 0xef:
+		return upload.MetadataOther, true
+	default:
+		return 0, false
+	}
+}
+
+// jpegName returns the name of a JPEG marker
+func jpegName(marker byte) string {
+	if marker == 0xfe {
+		return "COM"
+	}
+	return fmt.Sprintf("APP%d", marker-0xe0)
+}
+
+// jpeg removes the APPn and COM segments of a JPEG and the data following its EOI
+func (s *stripper) jpeg(content []byte) ([]byte, []upload.MetadataSegment, error) {
+	out := make([]byte, 0, len(content))
+	out = append(out, content[:2]...)
+	// The minimal EXIF follows SOI and JFIF
+	exifAt := len(out)
+
+	i := 2
+	for i < len(content) {
+		if i+2 > len(content) || content[i] != 0xff {
+			return nil, nil, fmt.Errorf("%w: marker expected at %d", ErrMalformed, i)
+		}
+		marker := content[i+1]
+		switch {
+		case marker == 0xff:
+			// Fill byte
+			i++
+			continue
+		case marker == 0xd9:
+			out = append(out, content[i:i+2]...)
+			i += 2
+			if i < len(content) && !s.remove(upload.MetadataOther, "trailer", len(content)-i) {
+				out = append(out, content[i:]...)
+			}
+			i = len(content)
+			continue
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7):
+			// Standalone markers
+			out = append(out, content[i:i+2]...)
+			i += 2
+			continue
+		}
+
+		if i+4 > len(content) {
+			return nil, nil, fmt.Errorf("%w: truncated segment at %d", ErrMalformed, i)
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(content[i+2:]))
+		if end > len(content) || end < i+4 {
+			return nil, nil, fmt.Errorf("%w: segment length at %d", ErrMalformed, i)
+		}
+
+		kind, isMetadata := jpegKind(marker, content[i+4:end])
+		if !isMetadata || !s.remove(kind, jpegName(marker), end-i) {
+			out = append(out, content[i:end]...)
+			if marker == 0xe0 && exifAt == 2 {
+				exifAt = len(out)
+			}
+		}
+
+		if marker == 0xda {
+			// Entropy coded data runs up to the next marker
+			next := scanEnd(content, end)
+			out = append(out, content[end:next]...)
+			end = next
+		}
+		i = end
+	}
+
+	if tiff := s.orientationTIFF(); tiff != nil {
+		app1 := append(append([]byte{}, exifHeader...), tiff...)
+		segment := []byte{0xff, 0xe1, byte((len(app1) + 2) >> 8), byte(len(app1) + 2)}
+		segment = append(segment, app1...)
+		out = append(out[:exifAt], append(segment, out[exifAt:]...)...)
+	}
+
+	return out, s.removed, nil
+}
+
+// scanEnd returns the position of the first marker following the entropy coded data starting at i
+func scanEnd(content []byte, i int) int {
+	for ; i+1 < len(content); i++ {
+		if content[i] != 0xff {
+			continue
+		}
+		// Stuffed zeros, restart markers and fill bytes belong to the data
+		if next := content[i+1]; next != 0x00 && next != 0xff && (next < 0xd0 || next > 0xd7) {
+			return i
+		}
+	}
+	return len(content)
+}
+
+// pngSignature starts every PNG
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// textKinds are the kinds of textual PNG chunks by keyword, other ones being MetadataText
+var textKinds = map[string]upload.MetadataKind{
+	"XML:com.adobe.xmp":     upload.MetadataXMP,
+	"Raw profile type exif": upload.MetadataEXIF,
+	"Raw profile type APP1": upload.MetadataEXIF,
+	"Raw profile type iptc": upload.MetadataIPTC,
+	"Raw profile type 8bim": upload.MetadataIPTC,
+	"Raw profile type xmp":  upload.MetadataXMP,
+	"Raw profile type icc":  upload.MetadataICC,
+	"Raw profile type icm":  upload.MetadataICC,
+}
+
+// pngKind returns the kind of metadata of a PNG chunk, false if it is not metadata
+func pngKind(name string, data []byte) (upload.MetadataKind, bool) {
+	switch name {
+	case "eXIf":
+		return upload.MetadataEXIF, true
+	case "iCCP":
+		return upload.MetadataICC, true
+	case "tEXt", "zTXt", "iTXt":
+		keyword, _, _ := bytes.Cut(data, []byte{0})
+		if kind, ok := textKinds[string(keyword)]; ok {
+			return kind, true
+		}
+		return upload.MetadataText, true
+	case "tIME":
+		return upload.MetadataOther, true
+	default:
+		return 0, false
+	}
+}
+
+// png removes the metadata chunks of a PNG and the data following its IEND chunk
+func (s *stripper) png(content []byte) ([]byte, []upload.MetadataSegment, error) {
+	out := make([]byte, 0, len(content))
+	out = append(out, pngSignature...)
+	// The minimal EXIF follows IHDR
+	exifAt := 0
+
+	i := len(pngSignature)
+	for i < len(content) {
+		if i+8 > len(content) {
+			return nil, nil, fmt.Errorf("%w: truncated chunk at %d", ErrMalformed, i)
+		}
+		length := int64(binary.BigEndian.Uint32(content[i:]))
+		name := string(content[i+4 : i+8])
+		if int64(i)+12+length > int64(len(content)) {
+			return nil, nil, fmt.Errorf("%w: chunk length at %d", ErrMalformed, i)
+		}
+		end := i + 12 + int(length)
+
+		kind, isMetadata := pngKind(name, content[i+8:end-4])
+		if !isMetadata || !s.remove(kind, name, end-i) {
+			out = append(out, content[i:end]...)
+		}
+		if name == "IHDR" {
+			exifAt = len(out)
+		}
+
+		i = end
+		if name == "IEND" {
+			if i < len(content) && !s.remove(upload.MetadataOther, "trailer", len(content)-i) {
+				out = append(out, content[i:]...)
+			}
+			break
+		}
+	}
+
+	if tiff := s.orientationTIFF(); tiff != nil && exifAt > 0 {
+		chunk := binary.BigEndian.AppendUint32(nil, uint32(len(tiff)))
+		chunk = append(chunk, "eXIf"...)
+		chunk = append(chunk, tiff...)
+		chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+		out = append(out[:exifAt], append(chunk, out[exifAt:]...)...)
+	}
+
+	return out, s.removed, nil
+}
+
+// isWebP checks if content is a WebP RIFF container
+func isWebP(content []byte) bool {
+	return len(content) >= 12 && string(content[:4]) == "RIFF" && string(content[8:12]) == "WEBP"
+}
+
+// Flags of the VP8X chunk of WebP
+const (
+	webpICC  = 0x20
+	webpEXIF = 0x08
+	webpXMP  = 0x04
+)
+
+// webpKinds are the kinds of metadata chunks of WebP and their VP8X flag
+var webpKinds = map[string]struct {
+	kind upload.MetadataKind
+	flag byte
+}{
+	"EXIF": {upload.MetadataEXIF, webpEXIF},
+	"XMP ": {upload.MetadataXMP, webpXMP},
+	"ICCP": {upload.MetadataICC, webpICC},
+}
+
+// webp removes the metadata chunks of a WebP, clearing their VP8X flags
+func (s *stripper) webp(content []byte) ([]byte, []upload.MetadataSegment, error) {
+	size := int64(binary.LittleEndian.Uint32(content[4:])) + 8
+	if size > int64(len(content)) || size < 12 {
+		return nil, nil, fmt.Errorf("%w: RIFF size", ErrMalformed)
+	}
+
+	out := make([]byte, 0, len(content))
+	out = append(out, content[:12]...)
+	vp8x := -1
+
+	for i := 12; i < int(size); {
+		if i+8 > int(size) {
+			return nil, nil, fmt.Errorf("%w: truncated chunk at %d", ErrMalformed, i)
+		}
+		name := string(content[i : i+4])
+		length := int64(binary.LittleEndian.Uint32(content[i+4:]))
+		if int64(i)+8+length > size {
+			return nil, nil, fmt.Errorf("%w: chunk length at %d", ErrMalformed, i)
+		}
+		// Chunks are padded to an even size, but for the last one of some files
+		end := i + 8 + int(length) + int(length%2)
+		if end > int(size) {
+			end = int(size)
+		}
+
+		if m, ok := webpKinds[name]; ok && s.remove(m.kind, name, end-i) {
+			if vp8x >= 0 {
+				out[vp8x+8] &^= m.flag
+			}
+		} else {
+			if name == "VP8X" && length >= 10 {
+				vp8x = len(out)
+			}
+			out = append(out, content[i:end]...)
+		}
+		i = end
+	}
+
+	// Extended WebP only hold EXIF
+	if tiff := s.orientationTIFF(); tiff != nil && vp8x >= 0 {
+		out = append(out, "EXIF"...)
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(tiff)))
+		out = append(out, tiff...)
+		if len(tiff)%2 == 1 {
+			out = append(out, 0)
+		}
+		out[vp8x+8] |= webpEXIF
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+
+	if size < int64(len(content)) && !s.remove(upload.MetadataOther, "trailer", len(content)-int(size)) {
+		out = append(out, content[size:]...)
+	}
+
+	return out, s.removed, nil
+}
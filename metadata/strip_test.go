@@ -0,0 +1,200 @@
+package metadata_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/exif"
+	"go.lsl.digital/lardwaz/upload/metadata"
+	_ "golang.org/x/image/webp"
+)
+
+const testDataFolder = "../testdata"
+
+// segment is a removed segment without its size
+type segment struct {
+	kind upload.MetadataKind
+	name string
+}
+
+func TestStrip(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		keep        []upload.MetadataKind
+		wantRemoved []segment
+		added       int      // Size of the minimal EXIF holding the orientation
+		wantAbsent  []string // Metadata values removed
+		wantPresent []string // Metadata values kept
+	}{
+		{
+			"jpeg", "metadata.jpg", nil,
+			[]segment{{upload.MetadataEXIF, "APP1"}, {upload.MetadataXMP, "APP1"}, {upload.MetadataICC, "APP2"}, {upload.MetadataIPTC, "APP13"}, {upload.MetadataText, "COM"}, {upload.MetadataOther, "trailer"}},
+			36, []string{"SN-0123456789", "Canon", "Jane", "fake icc", "Le Morne", "TRAILER-DATA"}, nil,
+		},
+		{
+			"jpeg_keep_icc", "metadata.jpg", []upload.MetadataKind{upload.MetadataICC},
+			[]segment{{upload.MetadataEXIF, "APP1"}, {upload.MetadataXMP, "APP1"}, {upload.MetadataIPTC, "APP13"}, {upload.MetadataText, "COM"}, {upload.MetadataOther, "trailer"}},
+			36, []string{"SN-0123456789", "Jane"}, []string{"fake icc"},
+		},
+		{
+			"jpeg_keep_exif", "metadata.jpg", []upload.MetadataKind{upload.MetadataEXIF, upload.MetadataIPTC},
+			[]segment{{upload.MetadataXMP, "APP1"}, {upload.MetadataICC, "APP2"}, {upload.MetadataText, "COM"}, {upload.MetadataOther, "trailer"}},
+			0, []string{"dc:creator", "Shot by"}, []string{"SN-0123456789", "Le Morne"},
+		},
+		{
+			"jpeg_without_metadata", "normal.jpg", nil, nil, 0, nil, nil,
+		},
+		{
+			"progressive_jpeg", "progressive_normal_out.jpg-thumb", nil, nil, 0, nil, nil,
+		},
+		{
+			"png", "metadata.png", nil,
+			[]segment{{upload.MetadataEXIF, "eXIf"}, {upload.MetadataICC, "iCCP"}, {upload.MetadataText, "tEXt"}, {upload.MetadataXMP, "iTXt"}, {upload.MetadataOther, "tIME"}},
+			38, []string{"SN-0123456789", "Jane", "fake"}, nil,
+		},
+		{
+			"png_keep_text", "metadata.png", []upload.MetadataKind{upload.MetadataText, upload.MetadataXMP},
+			[]segment{{upload.MetadataEXIF, "eXIf"}, {upload.MetadataICC, "iCCP"}, {upload.MetadataOther, "tIME"}},
+			38, []string{"SN-0123456789"}, []string{"Shot by Jane", "dc:creator"},
+		},
+		{
+			"webp", "metadata.webp", nil,
+			[]segment{{upload.MetadataICC, "ICCP"}, {upload.MetadataEXIF, "EXIF"}, {upload.MetadataXMP, "XMP "}},
+			34, []string{"SN-0123456789", "Jane", "fake icc"}, nil,
+		},
+		{
+			"gif", "normal.gif", nil, nil, 0, nil, nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := ioutil.ReadFile(filepath.Join(testDataFolder, tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, removed, err := metadata.Strip(content, tt.keep...)
+			if err != nil {
+				t.Fatalf("Strip() error = %v", err)
+			}
+
+			var segments []segment
+			size := 0
+			for _, r := range removed {
+				segments = append(segments, segment{r.Kind, r.Name})
+				size += r.Size
+			}
+			if !reflect.DeepEqual(segments, tt.wantRemoved) {
+				t.Errorf("Strip() removed = %v, want %v", segments, tt.wantRemoved)
+			}
+			if len(content)-size+tt.added != len(got) {
+				t.Errorf("Strip() = %d bytes, want %d - %d removed + %d added", len(got), len(content), size, tt.added)
+			}
+
+			for _, s := range tt.wantAbsent {
+				if bytes.Contains(got, []byte(s)) {
+					t.Errorf("Strip() kept %q", s)
+				}
+			}
+			for _, s := range tt.wantPresent {
+				if !bytes.Contains(got, []byte(s)) {
+					t.Errorf("Strip() removed %q", s)
+				}
+			}
+
+			if o, want := exif.Orientation(got), exif.Orientation(content); o != want {
+				t.Errorf("Orientation() = %v, want %v", o, want)
+			}
+
+			// Pixels are kept as is
+			if want, got := decode(t, content), decode(t, got); !bytes.Equal(want.Pix, got.Pix) || want.Rect != got.Rect {
+				t.Errorf("Strip() changed pixels")
+			}
+		})
+	}
+}
+
+func TestStripWebPFlags(t *testing.T) {
+	content, err := ioutil.ReadFile(filepath.Join(testDataFolder, "metadata.webp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		keep []upload.MetadataKind
+		want byte
+	}{
+		{"strip_all", nil, 0x08}, // Minimal EXIF holding the orientation
+		{"keep_icc", []upload.MetadataKind{upload.MetadataICC}, 0x20 | 0x08},
+		{"keep_xmp", []upload.MetadataKind{upload.MetadataXMP}, 0x04 | 0x08},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := metadata.Strip(content, tt.keep...)
+			if err != nil {
+				t.Fatalf("Strip() error = %v", err)
+			}
+			// VP8X is the first chunk, flags its first byte
+			if string(got[12:16]) != "VP8X" || got[20] != tt.want {
+				t.Errorf("VP8X flags = %#x, want %#x", got[20], tt.want)
+			}
+			if size := int(got[4]) | int(got[5])<<8 | int(got[6])<<16 | int(got[7])<<24; size != len(got)-8 {
+				t.Errorf("RIFF size = %d, want %d", size, len(got)-8)
+			}
+		})
+	}
+}
+
+func TestStripMalformed(t *testing.T) {
+	jpeg, err := ioutil.ReadFile(filepath.Join(testDataFolder, "metadata.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	png, err := ioutil.ReadFile(filepath.Join(testDataFolder, "metadata.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{"jpeg_truncated_segment", jpeg[:30]},
+		{"jpeg_no_marker", append([]byte{0xff, 0xd8, 0x00}, jpeg[3:]...)},
+		{"png_truncated_chunk", png[:40]},
+		{"webp_riff_size", []byte("RIFF\xff\xff\xff\x00WEBPVP8X")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := metadata.Strip(tt.content); !errors.Is(err, metadata.ErrMalformed) {
+				t.Errorf("Strip() error = %v, want %v", err, metadata.ErrMalformed)
+			}
+		})
+	}
+}
+
+// decode returns the pixels of an image
+func decode(t *testing.T, content []byte) *image.RGBA {
+	t.Helper()
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Rect, img, img.Bounds().Min, draw.Src)
+	return rgba
+}
@@ -1,6 +1,8 @@
 package upload
 
 import (
+	"time"
+
 	"github.com/h2non/filetype/types"
 )
 
@@ -25,6 +27,27 @@ type Options interface {
 	ConvertTo(t types.Type) types.Type
 	SetConvertTo(old types.Type, new types.Type) Options
 	FileTypeExist(t types.Type) bool
+	Storage() Storage
+	SetStorage(s Storage) Options
+	PathTemplate() string
+	SetPathTemplate(t string) Options
+	Collision() int
+	SetCollision(c int) Options
+	ContentAddressed() bool
+	SetContentAddressed(b bool) Options
+	ShardDepth() int
+	SetShardDepth(d int) Options
+	Events() Events
+	SetEvents(e Events) Options
+	// StripMetadata checks if metadata is removed from images before they are saved
+	StripMetadata() bool
+	SetStripMetadata(b bool) Options
+	// KeepMetadata returns the kinds of metadata kept when stripping metadata
+	KeepMetadata() []MetadataKind
+	SetKeepMetadata(kinds ...MetadataKind) Options
+	// ExtractMetadata checks if the metadata of images is read before they are saved
+	ExtractMetadata() bool
+	SetExtractMetadata(b bool) Options
 }
 
 // OptionsImage represents a set of image processing options
@@ -36,6 +59,33 @@ type OptionsImage interface {
 	SetMinHeight(h int) OptionsImage
 	Formats() OptionsFormats
 	SetFormats(opts OptionsFormats) OptionsImage
+	Retry() OptionsRetry
+	SetRetry(opts ...func(OptionsRetry)) OptionsImage
+	// FormatConcurrency returns the number of formats of an image generated at once
+	FormatConcurrency() int
+	SetFormatConcurrency(n int) OptionsImage
+	// DeriveFormats checks if formats are resized from larger formats rather than from the original
+	DeriveFormats() bool
+	SetDeriveFormats(d bool) OptionsImage
+	Events() Events
+	SetEvents(e Events) OptionsImage
+}
+
+// OptionsRetry represents a retry policy of failing processing steps
+type OptionsRetry interface {
+	MaxAttempts() int
+	SetMaxAttempts(n int) OptionsRetry
+	InitialBackoff() time.Duration
+	SetInitialBackoff(d time.Duration) OptionsRetry
+	MaxBackoff() time.Duration
+	SetMaxBackoff(d time.Duration) OptionsRetry
+	Multiplier() float64
+	SetMultiplier(m float64) OptionsRetry
+	Jitter() float64
+	SetJitter(j float64) OptionsRetry
+	// Classifier returns the function checking if a step failing with an error may succeed when tried again
+	Classifier() func(error) bool
+	SetClassifier(fn func(error) bool) OptionsRetry
 }
 
 // OptionsFormats represents a list of OptionsFormat
@@ -68,6 +118,38 @@ type OptionsFormat interface {
 	SetBackdrop(opts ...func(OptionsBackdrop)) OptionsFormat
 	Watermark() OptionsWatermark
 	SetWatermark(opts ...func(OptionsWatermark)) OptionsFormat
+	Resampling() int
+	SetResampling(r int) OptionsFormat
+	// OutputType returns the type the format is encoded to, the type of the original if empty
+	OutputType() types.Type
+	SetOutputType(t types.Type) OptionsFormat
+	// Lossless checks if WebP formats are losslessly encoded
+	Lossless() bool
+	SetLossless(l bool) OptionsFormat
+	// Quality returns the quality (1-100) of JPEG and lossy WebP formats, 0 for the encoder default
+	Quality() int
+	SetQuality(q int) OptionsFormat
+	// Progressive checks if JPEG formats are progressive rather than baseline
+	Progressive() bool
+	SetProgressive(p bool) OptionsFormat
+	// Compression returns the compression level of PNG formats
+	Compression() int
+	SetCompression(c int) OptionsFormat
+	// Colors returns the palette size (1-256) of GIF formats
+	Colors() int
+	SetColors(n int) OptionsFormat
+	// Dither checks if GIF formats are dithered to their palette
+	Dither() bool
+	SetDither(d bool) OptionsFormat
+	// Suffix returns the suffix added to the path of the original to name the format (e.g -thumb or -thumb.webp)
+	Suffix() string
+	// Steps returns custom steps run after the watermark, before encoding.
+	// Steps wrapped by Before or After are placed next to the step of the pipeline with the given name
+	// instead (decode, auto_orient, resize, crop, backdrop, watermark or encode), in the order listed,
+	// so they may also be placed next to custom steps listed earlier. Naming a step missing from the
+	// pipeline of a format fails its generation.
+	Steps() []Step
+	SetSteps(steps ...Step) OptionsFormat
 }
 
 // OptionsBackdrop represents a set of backdrop processing options
@@ -89,3 +171,15 @@ type OptionsWatermark interface {
 	OffsetY() int
 	SetOffsetY(y int) OptionsWatermark
 }
+
+// OptionsPool represents a set of worker pool options
+type OptionsPool interface {
+	Concurrency() int
+	SetConcurrency(n int) OptionsPool
+	QueueDepth() int
+	SetQueueDepth(n int) OptionsPool
+	MaxMemory() int64
+	SetMaxMemory(b int64) OptionsPool
+	Backpressure() int
+	SetBackpressure(b int) OptionsPool
+}
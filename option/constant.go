@@ -3,4 +3,61 @@ package option
 const (
 	// NoLimit define no limits
 	NoLimit = -1
+
+	// DefaultPathTemplate is the default path of uploaded files, relative to Dir and MediaPrefixURL
+	DefaultPathTemplate = "{dest}/{yyyy}/{month}/{slug}_{timestamp}{ext}"
+)
+
+// Handling of new files named after an existing file
+const (
+	// CollisionRename retries with a random suffix added to the name
+	CollisionRename = iota
+	// CollisionFail fails with upload.ErrFileExists
+	CollisionFail
+	// CollisionOverwrite replaces the existing file
+	CollisionOverwrite
+)
+
+// Handling of new jobs when a processing queue is full
+const (
+	// BackpressureBlock waits for room in the queue
+	BackpressureBlock = iota
+	// BackpressureReject fails with upload.ErrQueueFull
+	BackpressureReject
+	// BackpressureDrop drops the oldest queued job to make room
+	BackpressureDrop
+)
+
+// Resampling filters used to resize formats
+const (
+	// ResampleLanczos is a high quality filter, the slowest one
+	ResampleLanczos = iota
+	// ResampleCatmullRom is a sharp cubic filter
+	ResampleCatmullRom
+	// ResampleLinear is a bilinear filter
+	ResampleLinear
+	// ResampleBox averages pixels, fast for downscaling
+	ResampleBox
+	// ResampleNearestNeighbor is the fastest filter, without smoothing
+	ResampleNearestNeighbor
+)
+
+// Dispatching of events to subscribed functions
+const (
+	// DispatchSync calls subscribed functions before Emit returns
+	DispatchSync = iota
+	// DispatchAsync calls subscribed functions in order from another goroutine
+	DispatchAsync
+)
+
+// Compression levels of PNG formats
+const (
+	// CompressionDefault is the default compression of the encoder
+	CompressionDefault = iota
+	// CompressionNone does not compress
+	CompressionNone
+	// CompressionBestSpeed compresses fast
+	CompressionBestSpeed
+	// CompressionBest compresses the most, slowly
+	CompressionBest
 )
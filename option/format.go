@@ -1,19 +1,40 @@
 package option
 
-import "go.lsl.digital/lardwaz/upload"
+import (
+	"github.com/h2non/filetype/types"
+	"go.lsl.digital/lardwaz/upload"
+)
 
 // OptsFormat holds dimensions options for Format
 type OptsFormat struct {
-	name      string
-	width     int
-	height    int
-	backdrop  upload.OptionsBackdrop  // (default: nil) If not nil, will add a backdrop
-	watermark upload.OptionsWatermark // (default: nil) If not nil, will overlay an image as watermark at X,Y pos +-OffsetX,OffsetY
+	name        string
+	width       int
+	height      int
+	backdrop    upload.OptionsBackdrop  // (default: nil) If not nil, will add a backdrop
+	watermark   upload.OptionsWatermark // (default: nil) If not nil, will overlay an image as watermark at X,Y pos +-OffsetX,OffsetY
+	resampling  int                     // (default: ResampleLanczos) Filter used to resize
+	outputType  types.Type              // (default: empty) If set, the format is encoded to this type (JPEG, PNG, GIF, or WEBP once converter/webp is imported)
+	lossless    bool                    // (default: false) If true, WebP formats are lossless
+	quality     int                     // (default: 0) Quality (1-100) of JPEG and lossy WebP formats, 0 for the encoder default (95 and 75)
+	progressive bool                    // (default: false) If true, JPEG formats are progressive
+	compression int                     // (default: CompressionDefault) Compression level of PNG formats
+	colors      int                     // (default: 256) Palette size (1-256) of GIF formats
+	dither      bool                    // (default: true) If true, GIF formats are dithered with Floyd-Steinberg
+	steps       []upload.Step           // (default: nil) Custom steps run before encoding, or next to the step they are placed at
 }
 
+// Bounds of encoder settings
+const (
+	maxQuality = 100
+	maxColors  = 256
+)
+
 // NewFormat returns a new OptionsFormat
 func NewFormat() upload.OptionsFormat {
-	return &OptsFormat{}
+	return &OptsFormat{
+		colors: maxColors,
+		dither: true,
+	}
 }
 
 // Name returns Name
@@ -76,13 +97,153 @@ func (o *OptsFormat) SetWatermark(opts ...func(upload.OptionsWatermark)) upload.
 	return o
 }
 
-// EvaluateFormatOptions returns optionsImage
+// Resampling returns Resampling
+func (o OptsFormat) Resampling() int {
+	return o.resampling
+}
+
+// SetResampling sets the Resampling
+func (o *OptsFormat) SetResampling(r int) upload.OptionsFormat {
+	o.resampling = r
+
+	return o
+}
+
+// OutputType returns OutputType
+func (o OptsFormat) OutputType() types.Type {
+	return o.outputType
+}
+
+// SetOutputType sets the OutputType
+func (o *OptsFormat) SetOutputType(t types.Type) upload.OptionsFormat {
+	o.outputType = t
+
+	return o
+}
+
+// Lossless returns Lossless
+func (o OptsFormat) Lossless() bool {
+	return o.lossless
+}
+
+// SetLossless sets Lossless
+func (o *OptsFormat) SetLossless(l bool) upload.OptionsFormat {
+	o.lossless = l
+
+	return o
+}
+
+// Quality returns Quality
+func (o OptsFormat) Quality() int {
+	return o.quality
+}
+
+// SetQuality sets the Quality
+func (o *OptsFormat) SetQuality(q int) upload.OptionsFormat {
+	o.quality = q
+
+	return o
+}
+
+// Progressive returns Progressive
+func (o OptsFormat) Progressive() bool {
+	return o.progressive
+}
+
+// SetProgressive sets Progressive
+func (o *OptsFormat) SetProgressive(p bool) upload.OptionsFormat {
+	o.progressive = p
+
+	return o
+}
+
+// Compression returns Compression
+func (o OptsFormat) Compression() int {
+	return o.compression
+}
+
+// SetCompression sets the Compression
+func (o *OptsFormat) SetCompression(c int) upload.OptionsFormat {
+	o.compression = c
+
+	return o
+}
+
+// Colors returns Colors
+func (o OptsFormat) Colors() int {
+	return o.colors
+}
+
+// SetColors sets the Colors
+func (o *OptsFormat) SetColors(n int) upload.OptionsFormat {
+	o.colors = n
+
+	return o
+}
+
+// Dither returns Dither
+func (o OptsFormat) Dither() bool {
+	return o.dither
+}
+
+// SetDither sets Dither
+func (o *OptsFormat) SetDither(d bool) upload.OptionsFormat {
+	o.dither = d
+
+	return o
+}
+
+// Suffix returns the suffix of the paths of the format, with the extension of OutputType if set
+func (o OptsFormat) Suffix() string {
+	if o.outputType.Extension == "" {
+		return "-" + o.name
+	}
+
+	return "-" + o.name + "." + o.outputType.Extension
+}
+
+// Steps returns Steps
+func (o OptsFormat) Steps() []upload.Step {
+	return o.steps
+}
+
+// SetSteps sets the Steps
+func (o *OptsFormat) SetSteps(steps ...upload.Step) upload.OptionsFormat {
+	o.steps = steps
+
+	return o
+}
+
+// EvaluateFormatOptions returns optionsImage, with encoder settings out of bounds clamped to them
 func EvaluateFormatOptions(opts ...func(upload.OptionsFormat)) upload.OptionsFormat {
 	optCopy := NewFormat()
 	for _, o := range opts {
 		o(optCopy)
 	}
-	return optCopy
+	return validateFormat(optCopy)
+}
+
+// validateFormat clamps the encoder settings of o to their bounds
+func validateFormat(o upload.OptionsFormat) upload.OptionsFormat {
+	o.SetQuality(clamp(o.Quality(), 0, maxQuality))
+	o.SetColors(clamp(o.Colors(), 1, maxColors))
+
+	if c := o.Compression(); c < CompressionDefault || c > CompressionBest {
+		o.SetCompression(CompressionDefault)
+	}
+
+	return o
+}
+
+// clamp returns v bounded to [lo, hi]
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
 }
 
 // FormatName returns a function to modify format Name
@@ -119,3 +280,66 @@ func FormatWatermark(opts ...func(upload.OptionsWatermark)) func(upload.OptionsF
 		o.SetWatermark(opts...)
 	}
 }
+
+// FormatResampling returns a function to modify format Resampling
+func FormatResampling(r int) func(upload.OptionsFormat) {
+	return func(o upload.OptionsFormat) {
+		o.SetResampling(r)
+	}
+}
+
+// FormatOutputType returns a function to modify format OutputType
+func FormatOutputType(t types.Type) func(upload.OptionsFormat) {
+	return func(o upload.OptionsFormat) {
+		o.SetOutputType(t)
+	}
+}
+
+// FormatLossless returns a function to modify format Lossless
+func FormatLossless(l bool) func(upload.OptionsFormat) {
+	return func(o upload.OptionsFormat) {
+		o.SetLossless(l)
+	}
+}
+
+// FormatQuality returns a function to modify format Quality
+func FormatQuality(q int) func(upload.OptionsFormat) {
+	return func(o upload.OptionsFormat) {
+		o.SetQuality(q)
+	}
+}
+
+// FormatProgressive returns a function to modify format Progressive
+func FormatProgressive(p bool) func(upload.OptionsFormat) {
+	return func(o upload.OptionsFormat) {
+		o.SetProgressive(p)
+	}
+}
+
+// FormatCompression returns a function to modify format Compression
+func FormatCompression(c int) func(upload.OptionsFormat) {
+	return func(o upload.OptionsFormat) {
+		o.SetCompression(c)
+	}
+}
+
+// FormatColors returns a function to modify format Colors
+func FormatColors(n int) func(upload.OptionsFormat) {
+	return func(o upload.OptionsFormat) {
+		o.SetColors(n)
+	}
+}
+
+// FormatDither returns a function to modify format Dither
+func FormatDither(d bool) func(upload.OptionsFormat) {
+	return func(o upload.OptionsFormat) {
+		o.SetDither(d)
+	}
+}
+
+// FormatSteps returns a function to modify format Steps
+func FormatSteps(steps ...upload.Step) func(upload.OptionsFormat) {
+	return func(o upload.OptionsFormat) {
+		o.SetSteps(steps...)
+	}
+}
@@ -6,6 +6,8 @@ import (
 
 	"go.lsl.digital/lardwaz/upload"
 	"go.lsl.digital/lardwaz/upload/option"
+	"go.lsl.digital/lardwaz/upload/processor/step"
+	utypes "go.lsl.digital/lardwaz/upload/types"
 )
 
 func TestEvaluateFormatOptions(t *testing.T) {
@@ -22,6 +24,15 @@ func TestEvaluateFormatOptions(t *testing.T) {
 		{"format_height", []func(upload.OptionsFormat){option.FormatHeight(100)}, option.NewFormat().SetHeight(100)},
 		{"format_backdrop", []func(upload.OptionsFormat){option.FormatBackdrop(option.BackdropPath("/abc/def"))}, option.NewFormat().SetBackdrop(option.BackdropPath("/abc/def"))},
 		{"format_watermark", []func(upload.OptionsFormat){option.FormatWatermark(option.WatermarkPath("/abc/def"), option.WatermarkVertical(10))}, option.NewFormat().SetWatermark(option.WatermarkPath("/abc/def"), option.WatermarkVertical(10))},
+		{"format_resampling", []func(upload.OptionsFormat){option.FormatResampling(option.ResampleBox)}, option.NewFormat().SetResampling(option.ResampleBox)},
+		{"format_output_type", []func(upload.OptionsFormat){option.FormatOutputType(utypes.TypeWEBP)}, option.NewFormat().SetOutputType(utypes.TypeWEBP)},
+		{"format_lossless", []func(upload.OptionsFormat){option.FormatLossless(true)}, option.NewFormat().SetLossless(true)},
+		{"format_quality", []func(upload.OptionsFormat){option.FormatQuality(60)}, option.NewFormat().SetQuality(60)},
+		{"format_progressive", []func(upload.OptionsFormat){option.FormatProgressive(true)}, option.NewFormat().SetProgressive(true)},
+		{"format_compression", []func(upload.OptionsFormat){option.FormatCompression(option.CompressionBest)}, option.NewFormat().SetCompression(option.CompressionBest)},
+		{"format_colors", []func(upload.OptionsFormat){option.FormatColors(16)}, option.NewFormat().SetColors(16)},
+		{"format_dither", []func(upload.OptionsFormat){option.FormatDither(false)}, option.NewFormat().SetDither(false)},
+		{"format_steps", []func(upload.OptionsFormat){option.FormatSteps(step.Resize{Width: 100})}, option.NewFormat().SetSteps(step.Resize{Width: 100})},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -31,3 +42,54 @@ func TestEvaluateFormatOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatSuffix(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []func(upload.OptionsFormat)
+		want string
+	}{
+		{"original_type", []func(upload.OptionsFormat){option.FormatName("thumb")}, "-thumb"},
+		{"output_type", []func(upload.OptionsFormat){option.FormatName("thumb"), option.FormatOutputType(utypes.TypeWEBP)}, "-thumb.webp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := option.EvaluateFormatOptions(tt.opts...).Suffix(); got != tt.want {
+				t.Errorf("Suffix() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatEncoderBounds(t *testing.T) {
+	tests := []struct {
+		name            string
+		opts            []func(upload.OptionsFormat)
+		wantQuality     int
+		wantCompression int
+		wantColors      int
+	}{
+		{"defaults", nil, 0, option.CompressionDefault, 256},
+		{"in_bounds", []func(upload.OptionsFormat){option.FormatQuality(1), option.FormatCompression(option.CompressionNone), option.FormatColors(1)}, 1, option.CompressionNone, 1},
+		{"quality_negative", []func(upload.OptionsFormat){option.FormatQuality(-5)}, 0, option.CompressionDefault, 256},
+		{"quality_too_high", []func(upload.OptionsFormat){option.FormatQuality(150)}, 100, option.CompressionDefault, 256},
+		{"compression_unknown", []func(upload.OptionsFormat){option.FormatCompression(42)}, 0, option.CompressionDefault, 256},
+		{"compression_negative", []func(upload.OptionsFormat){option.FormatCompression(-1)}, 0, option.CompressionDefault, 256},
+		{"colors_zero", []func(upload.OptionsFormat){option.FormatColors(0)}, 0, option.CompressionDefault, 1},
+		{"colors_too_many", []func(upload.OptionsFormat){option.FormatColors(1000)}, 0, option.CompressionDefault, 256},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := option.EvaluateFormatOptions(tt.opts...)
+			if got.Quality() != tt.wantQuality {
+				t.Errorf("Quality() = %v, want %v", got.Quality(), tt.wantQuality)
+			}
+			if got.Compression() != tt.wantCompression {
+				t.Errorf("Compression() = %v, want %v", got.Compression(), tt.wantCompression)
+			}
+			if got.Colors() != tt.wantColors {
+				t.Errorf("Colors() = %v, want %v", got.Colors(), tt.wantColors)
+			}
+		})
+	}
+}
@@ -7,17 +7,23 @@ import (
 // OptsImage is an implementation of OptionsImage
 type OptsImage struct {
 	OptsENV
-	minWidth  int
-	minHeight int
-	formats   upload.OptionsFormats
+	minWidth          int
+	minHeight         int
+	formats           upload.OptionsFormats
+	retry             upload.OptionsRetry
+	formatConcurrency int           // (default: 1) Number of formats generated at once
+	deriveFormats     bool          // (default: false) Resize formats from the nearest larger format when quality allows
+	events            upload.Events // (default: nil) If not nil, generated formats and jobs are emitted to it
 }
 
 // NewImage returns a new upload.OptionsImage
 func NewImage() upload.OptionsImage {
 	return &OptsImage{
-		minWidth:  NoLimit,
-		minHeight: NoLimit,
-		formats:   NewOptionsFormats(),
+		minWidth:          NoLimit,
+		minHeight:         NoLimit,
+		formats:           NewOptionsFormats(),
+		retry:             NewRetry(),
+		formatConcurrency: 1,
 	}
 }
 
@@ -57,6 +63,54 @@ func (o *OptsImage) SetFormats(opts upload.OptionsFormats) upload.OptionsImage {
 	return o
 }
 
+// Retry returns Retry
+func (o OptsImage) Retry() upload.OptionsRetry {
+	return o.retry
+}
+
+// SetRetry sets Retry
+func (o *OptsImage) SetRetry(opts ...func(upload.OptionsRetry)) upload.OptionsImage {
+	o.retry = EvaluateRetryOptions(opts...)
+
+	return o
+}
+
+// FormatConcurrency returns FormatConcurrency
+func (o OptsImage) FormatConcurrency() int {
+	return o.formatConcurrency
+}
+
+// SetFormatConcurrency sets FormatConcurrency
+func (o *OptsImage) SetFormatConcurrency(n int) upload.OptionsImage {
+	o.formatConcurrency = n
+
+	return o
+}
+
+// DeriveFormats returns DeriveFormats
+func (o OptsImage) DeriveFormats() bool {
+	return o.deriveFormats
+}
+
+// SetDeriveFormats sets DeriveFormats
+func (o *OptsImage) SetDeriveFormats(d bool) upload.OptionsImage {
+	o.deriveFormats = d
+
+	return o
+}
+
+// Events returns Events
+func (o OptsImage) Events() upload.Events {
+	return o.events
+}
+
+// SetEvents sets Events
+func (o *OptsImage) SetEvents(e upload.Events) upload.OptionsImage {
+	o.events = e
+
+	return o
+}
+
 // EvaluateImageOptions returns optionsImage
 func EvaluateImageOptions(opts ...func(upload.OptionsImage)) upload.OptionsImage {
 	optCopy := NewImage()
@@ -93,6 +147,34 @@ func Formats(opts ...func(upload.OptionsFormat)) func(upload.OptionsImage) {
 	}
 }
 
+// Retry returns a function to modify Retry option image
+func Retry(opts ...func(upload.OptionsRetry)) func(upload.OptionsImage) {
+	return func(o upload.OptionsImage) {
+		o.SetRetry(opts...)
+	}
+}
+
+// FormatConcurrency returns a function to modify FormatConcurrency option image
+func FormatConcurrency(n int) func(upload.OptionsImage) {
+	return func(o upload.OptionsImage) {
+		o.SetFormatConcurrency(n)
+	}
+}
+
+// DeriveFormats returns a function to modify DeriveFormats option image
+func DeriveFormats(d bool) func(upload.OptionsImage) {
+	return func(o upload.OptionsImage) {
+		o.SetDeriveFormats(d)
+	}
+}
+
+// ImageEvents returns a function to modify Events option image
+func ImageEvents(e upload.Events) func(upload.OptionsImage) {
+	return func(o upload.OptionsImage) {
+		o.SetEvents(e)
+	}
+}
+
 // PROD returns a function to modify ENV
 func PROD() func(upload.OptionsImage) {
 	return func(o upload.OptionsImage) {
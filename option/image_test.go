@@ -5,10 +5,13 @@ import (
 	"testing"
 
 	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/event"
 	"go.lsl.digital/lardwaz/upload/option"
 )
 
 func TestEvaluateImageOptions(t *testing.T) {
+	bus := event.NewBus(option.DispatchSync)
+
 	tests := []struct {
 		name string
 		opts []func(upload.OptionsImage)
@@ -18,6 +21,9 @@ func TestEvaluateImageOptions(t *testing.T) {
 		{"nil", nil, option.NewImage()},
 		{"min_width", []func(upload.OptionsImage){option.MinWidth(100)}, option.NewImage().SetMinWidth(100)},
 		{"min_height", []func(upload.OptionsImage){option.MinHeight(100)}, option.NewImage().SetMinHeight(100)},
+		{"format_concurrency", []func(upload.OptionsImage){option.FormatConcurrency(4)}, option.NewImage().SetFormatConcurrency(4)},
+		{"derive_formats", []func(upload.OptionsImage){option.DeriveFormats(true)}, option.NewImage().SetDeriveFormats(true)},
+		{"events", []func(upload.OptionsImage){option.ImageEvents(bus)}, option.NewImage().SetEvents(bus)},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
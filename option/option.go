@@ -3,17 +3,27 @@ package option
 import (
 	"github.com/h2non/filetype/types"
 	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/storage"
 	utypes "go.lsl.digital/lardwaz/upload/types"
 )
 
 // Opts is an implementation of Options
 type Opts struct {
-	dir            string
-	destination    string
-	mediaPrefixURL string
-	fileType       []types.Type
-	maxSize        int
-	convertTo      map[types.Type]types.Type
+	dir             string
+	destination     string
+	mediaPrefixURL  string
+	fileType        []types.Type
+	maxSize         int
+	convertTo       map[types.Type]types.Type
+	storage         upload.Storage
+	pathTemplate    string
+	collision       int                   // (default: CollisionRename) Handling of new files named after an existing file
+	contentAddress  bool                  // (default: false) If true, files are named after the SHA-256 of their content
+	shardDepth      int                   // (default: 2) Number of 2 characters directories (ab/cd/) above content addressed files
+	events          upload.Events         // (default: nil) If not nil, uploads and deletions are emitted to it
+	stripMetadata   bool                  // (default: false) If true, metadata is removed from images before they are saved
+	keepMetadata    []upload.MetadataKind // (default: nil) Kinds of metadata kept when stripping metadata
+	extractMetadata bool                  // (default: false) If true, the metadata of images is read before it is stripped
 }
 
 // NewUpload return a new options
@@ -23,6 +33,9 @@ func NewUpload() upload.Options {
 		mediaPrefixURL: "/media/",
 		maxSize:        NoLimit,
 		convertTo:      make(map[types.Type]types.Type),
+		storage:        storage.NewLocal(),
+		pathTemplate:   DefaultPathTemplate,
+		shardDepth:     2,
 	}
 }
 
@@ -111,6 +124,114 @@ func (o Opts) FileTypeExist(t types.Type) bool {
 	return false
 }
 
+// Storage returns Storage
+func (o Opts) Storage() upload.Storage {
+	return o.storage
+}
+
+// SetStorage sets the Storage
+func (o *Opts) SetStorage(s upload.Storage) upload.Options {
+	o.storage = s
+
+	return o
+}
+
+// PathTemplate returns PathTemplate
+func (o Opts) PathTemplate() string {
+	return o.pathTemplate
+}
+
+// SetPathTemplate sets the PathTemplate
+func (o *Opts) SetPathTemplate(t string) upload.Options {
+	o.pathTemplate = t
+
+	return o
+}
+
+// Collision returns Collision
+func (o Opts) Collision() int {
+	return o.collision
+}
+
+// SetCollision sets the Collision
+func (o *Opts) SetCollision(c int) upload.Options {
+	o.collision = c
+
+	return o
+}
+
+// ContentAddressed returns ContentAddressed
+func (o Opts) ContentAddressed() bool {
+	return o.contentAddress
+}
+
+// SetContentAddressed sets the ContentAddressed
+func (o *Opts) SetContentAddressed(b bool) upload.Options {
+	o.contentAddress = b
+
+	return o
+}
+
+// Events returns Events
+func (o Opts) Events() upload.Events {
+	return o.events
+}
+
+// SetEvents sets the Events
+func (o *Opts) SetEvents(e upload.Events) upload.Options {
+	o.events = e
+
+	return o
+}
+
+// ShardDepth returns ShardDepth
+func (o Opts) ShardDepth() int {
+	return o.shardDepth
+}
+
+// SetShardDepth sets the ShardDepth
+func (o *Opts) SetShardDepth(d int) upload.Options {
+	o.shardDepth = d
+
+	return o
+}
+
+// StripMetadata returns StripMetadata
+func (o Opts) StripMetadata() bool {
+	return o.stripMetadata
+}
+
+// SetStripMetadata sets the StripMetadata
+func (o *Opts) SetStripMetadata(b bool) upload.Options {
+	o.stripMetadata = b
+
+	return o
+}
+
+// KeepMetadata returns KeepMetadata
+func (o Opts) KeepMetadata() []upload.MetadataKind {
+	return o.keepMetadata
+}
+
+// SetKeepMetadata sets the KeepMetadata
+func (o *Opts) SetKeepMetadata(kinds ...upload.MetadataKind) upload.Options {
+	o.keepMetadata = kinds
+
+	return o
+}
+
+// ExtractMetadata returns ExtractMetadata
+func (o Opts) ExtractMetadata() bool {
+	return o.extractMetadata
+}
+
+// SetExtractMetadata sets the ExtractMetadata
+func (o *Opts) SetExtractMetadata(b bool) upload.Options {
+	o.extractMetadata = b
+
+	return o
+}
+
 // EvaluateOptions returns list of options
 func EvaluateOptions(opts ...func(upload.Options)) upload.Options {
 	optCopy := NewUpload()
@@ -161,3 +282,54 @@ func ConvertTo(old, new types.Type) func(upload.Options) {
 		o.SetConvertTo(old, new)
 	}
 }
+
+// Storage returns a function to change Storage
+func Storage(s upload.Storage) func(upload.Options) {
+	return func(o upload.Options) {
+		o.SetStorage(s)
+	}
+}
+
+// PathTemplate returns a function to change PathTemplate (e.g "{dest}/{yyyy}/{mm}/{slug}-{uuid}{ext}")
+func PathTemplate(t string) func(upload.Options) {
+	return func(o upload.Options) {
+		o.SetPathTemplate(t)
+	}
+}
+
+// Collision returns a function to change Collision
+func Collision(c int) func(upload.Options) {
+	return func(o upload.Options) {
+		o.SetCollision(c)
+	}
+}
+
+// ContentAddressed returns a function to name files after their content with shard depth d
+func ContentAddressed(d int) func(upload.Options) {
+	return func(o upload.Options) {
+		o.SetContentAddressed(true)
+		o.SetShardDepth(d)
+	}
+}
+
+// Events returns a function to change Events
+func Events(e upload.Events) func(upload.Options) {
+	return func(o upload.Options) {
+		o.SetEvents(e)
+	}
+}
+
+// StripMetadata returns a function to remove metadata from images before they are saved, but the kinds of keep
+func StripMetadata(keep ...upload.MetadataKind) func(upload.Options) {
+	return func(o upload.Options) {
+		o.SetStripMetadata(true)
+		o.SetKeepMetadata(keep...)
+	}
+}
+
+// ExtractMetadata returns a function to read the metadata of images before they are saved
+func ExtractMetadata() func(upload.Options) {
+	return func(o upload.Options) {
+		o.SetExtractMetadata(true)
+	}
+}
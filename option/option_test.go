@@ -5,11 +5,15 @@ import (
 	"testing"
 
 	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/event"
 	"go.lsl.digital/lardwaz/upload/option"
+	"go.lsl.digital/lardwaz/upload/storage"
 	"go.lsl.digital/lardwaz/upload/types"
 )
 
 func TestEvaluateOptions(t *testing.T) {
+	bus := event.NewBus(option.DispatchSync)
+
 	tests := []struct {
 		name string
 		opts []func(upload.Options)
@@ -23,7 +27,15 @@ func TestEvaluateOptions(t *testing.T) {
 		{"file_type", []func(upload.Options){option.FileType(types.TypeJPEG)}, option.NewUpload().AddFileType(types.TypeJPEG)},
 		{"multiple file_type", []func(upload.Options){option.FileType(types.TypeJPEG), option.FileType(types.TypeMP4)}, option.NewUpload().AddFileType(types.TypeJPEG).AddFileType(types.TypeMP4)},
 		{"max_size", []func(upload.Options){option.MaxSize(1000)}, option.NewUpload().SetMaxSize(1000)},
+		{"storage", []func(upload.Options){option.Storage(storage.NewLocal())}, option.NewUpload().SetStorage(storage.NewLocal())},
+		{"path_template", []func(upload.Options){option.PathTemplate("{dest}/{uuid}{ext}")}, option.NewUpload().SetPathTemplate("{dest}/{uuid}{ext}")},
+		{"collision", []func(upload.Options){option.Collision(option.CollisionFail)}, option.NewUpload().SetCollision(option.CollisionFail)},
+		{"content_addressed", []func(upload.Options){option.ContentAddressed(3)}, option.NewUpload().SetContentAddressed(true).SetShardDepth(3)},
 		{"convert_to", []func(upload.Options){option.ConvertTo(types.TypeMP3, types.TypeAAC)}, option.NewUpload().SetConvertTo(types.TypeMP3, types.TypeAAC)},
+		{"events", []func(upload.Options){option.Events(bus)}, option.NewUpload().SetEvents(bus)},
+		{"strip_metadata", []func(upload.Options){option.StripMetadata()}, option.NewUpload().SetStripMetadata(true).SetKeepMetadata()},
+		{"strip_metadata_keep", []func(upload.Options){option.StripMetadata(upload.MetadataICC)}, option.NewUpload().SetStripMetadata(true).SetKeepMetadata(upload.MetadataICC)},
+		{"extract_metadata", []func(upload.Options){option.ExtractMetadata()}, option.NewUpload().SetExtractMetadata(true)},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
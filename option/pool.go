@@ -0,0 +1,113 @@
+package option
+
+import (
+	"runtime"
+
+	"go.lsl.digital/lardwaz/upload"
+)
+
+// DefaultQueueDepth is the default number of jobs waiting for a worker
+const DefaultQueueDepth = 100
+
+// OptsPool is an implementation of OptionsPool
+type OptsPool struct {
+	concurrency  int
+	queueDepth   int
+	maxMemory    int64
+	backpressure int
+}
+
+// NewPool returns a new upload.OptionsPool
+func NewPool() upload.OptionsPool {
+	return &OptsPool{
+		concurrency:  runtime.NumCPU(),
+		queueDepth:   DefaultQueueDepth,
+		maxMemory:    NoLimit,
+		backpressure: BackpressureBlock,
+	}
+}
+
+// Concurrency returns Concurrency
+func (o OptsPool) Concurrency() int {
+	return o.concurrency
+}
+
+// SetConcurrency sets Concurrency
+func (o *OptsPool) SetConcurrency(n int) upload.OptionsPool {
+	o.concurrency = n
+
+	return o
+}
+
+// QueueDepth returns QueueDepth
+func (o OptsPool) QueueDepth() int {
+	return o.queueDepth
+}
+
+// SetQueueDepth sets QueueDepth
+func (o *OptsPool) SetQueueDepth(n int) upload.OptionsPool {
+	o.queueDepth = n
+
+	return o
+}
+
+// MaxMemory returns MaxMemory
+func (o OptsPool) MaxMemory() int64 {
+	return o.maxMemory
+}
+
+// SetMaxMemory sets MaxMemory
+func (o *OptsPool) SetMaxMemory(b int64) upload.OptionsPool {
+	o.maxMemory = b
+
+	return o
+}
+
+// Backpressure returns Backpressure
+func (o OptsPool) Backpressure() int {
+	return o.backpressure
+}
+
+// SetBackpressure sets Backpressure
+func (o *OptsPool) SetBackpressure(b int) upload.OptionsPool {
+	o.backpressure = b
+
+	return o
+}
+
+// EvaluatePoolOptions returns optionsPool
+func EvaluatePoolOptions(opts ...func(upload.OptionsPool)) upload.OptionsPool {
+	optCopy := NewPool()
+	for _, o := range opts {
+		o(optCopy)
+	}
+	return optCopy
+}
+
+// Concurrency returns a function to modify Concurrency option pool
+func Concurrency(n int) func(upload.OptionsPool) {
+	return func(o upload.OptionsPool) {
+		o.SetConcurrency(n)
+	}
+}
+
+// QueueDepth returns a function to modify QueueDepth option pool
+func QueueDepth(n int) func(upload.OptionsPool) {
+	return func(o upload.OptionsPool) {
+		o.SetQueueDepth(n)
+	}
+}
+
+// MaxMemory returns a function to modify MaxMemory option pool
+func MaxMemory(b int64) func(upload.OptionsPool) {
+	return func(o upload.OptionsPool) {
+		o.SetMaxMemory(b)
+	}
+}
+
+// Backpressure returns a function to modify Backpressure option pool
+func Backpressure(b int) func(upload.OptionsPool) {
+	return func(o upload.OptionsPool) {
+		o.SetBackpressure(b)
+	}
+}
@@ -0,0 +1,31 @@
+package option_test
+
+import (
+	"reflect"
+	"testing"
+
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/option"
+)
+
+func TestEvaluatePoolOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []func(upload.OptionsPool)
+		want upload.OptionsPool
+	}{
+		{"empty", []func(upload.OptionsPool){}, option.NewPool()},
+		{"nil", nil, option.NewPool()},
+		{"concurrency", []func(upload.OptionsPool){option.Concurrency(2)}, option.NewPool().SetConcurrency(2)},
+		{"queue_depth", []func(upload.OptionsPool){option.QueueDepth(10)}, option.NewPool().SetQueueDepth(10)},
+		{"max_memory", []func(upload.OptionsPool){option.MaxMemory(1 << 30)}, option.NewPool().SetMaxMemory(1 << 30)},
+		{"backpressure", []func(upload.OptionsPool){option.Backpressure(option.BackpressureReject)}, option.NewPool().SetBackpressure(option.BackpressureReject)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := option.EvaluatePoolOptions(tt.opts...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EvaluatePoolOptions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package option
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.lsl.digital/lardwaz/upload"
+)
+
+// Default retry policy: a single attempt
+const (
+	DefaultMaxAttempts    = 1
+	DefaultInitialBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff     = 10 * time.Second
+	DefaultMultiplier     = 2
+	DefaultJitter         = 0.2
+)
+
+// OptsRetry is an implementation of OptionsRetry
+type OptsRetry struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	multiplier     float64
+	jitter         float64          // (default: 0.2) Fraction of the backoff randomly added or removed
+	classifier     func(error) bool // (default: nil) If nil, DefaultClassifier is used
+}
+
+// NewRetry returns a new OptionsRetry
+func NewRetry() upload.OptionsRetry {
+	return &OptsRetry{
+		maxAttempts:    DefaultMaxAttempts,
+		initialBackoff: DefaultInitialBackoff,
+		maxBackoff:     DefaultMaxBackoff,
+		multiplier:     DefaultMultiplier,
+		jitter:         DefaultJitter,
+	}
+}
+
+// MaxAttempts returns MaxAttempts
+func (o OptsRetry) MaxAttempts() int {
+	return o.maxAttempts
+}
+
+// SetMaxAttempts sets MaxAttempts
+func (o *OptsRetry) SetMaxAttempts(n int) upload.OptionsRetry {
+	o.maxAttempts = n
+
+	return o
+}
+
+// InitialBackoff returns InitialBackoff
+func (o OptsRetry) InitialBackoff() time.Duration {
+	return o.initialBackoff
+}
+
+// SetInitialBackoff sets InitialBackoff
+func (o *OptsRetry) SetInitialBackoff(d time.Duration) upload.OptionsRetry {
+	o.initialBackoff = d
+
+	return o
+}
+
+// MaxBackoff returns MaxBackoff
+func (o OptsRetry) MaxBackoff() time.Duration {
+	return o.maxBackoff
+}
+
+// SetMaxBackoff sets MaxBackoff
+func (o *OptsRetry) SetMaxBackoff(d time.Duration) upload.OptionsRetry {
+	o.maxBackoff = d
+
+	return o
+}
+
+// Multiplier returns Multiplier
+func (o OptsRetry) Multiplier() float64 {
+	return o.multiplier
+}
+
+// SetMultiplier sets Multiplier
+func (o *OptsRetry) SetMultiplier(m float64) upload.OptionsRetry {
+	o.multiplier = m
+
+	return o
+}
+
+// Jitter returns Jitter
+func (o OptsRetry) Jitter() float64 {
+	return o.jitter
+}
+
+// SetJitter sets Jitter
+func (o *OptsRetry) SetJitter(j float64) upload.OptionsRetry {
+	o.jitter = j
+
+	return o
+}
+
+// Classifier returns Classifier
+func (o OptsRetry) Classifier() func(error) bool {
+	if o.classifier == nil {
+		return DefaultClassifier
+	}
+
+	return o.classifier
+}
+
+// SetClassifier sets Classifier
+func (o *OptsRetry) SetClassifier(fn func(error) bool) upload.OptionsRetry {
+	o.classifier = fn
+
+	return o
+}
+
+// DefaultClassifier retries every error but cancellations and invalid images
+func DefaultClassifier(err error) bool {
+	return !errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded) &&
+		!errors.Is(err, upload.ErrInvalidImage)
+}
+
+// EvaluateRetryOptions returns OptionsRetry
+func EvaluateRetryOptions(opts ...func(upload.OptionsRetry)) upload.OptionsRetry {
+	optCopy := NewRetry()
+	for _, o := range opts {
+		o(optCopy)
+	}
+	return optCopy
+}
+
+// RetryMaxAttempts returns a function to modify retry MaxAttempts
+func RetryMaxAttempts(n int) func(upload.OptionsRetry) {
+	return func(o upload.OptionsRetry) {
+		o.SetMaxAttempts(n)
+	}
+}
+
+// RetryBackoff returns a function to modify retry InitialBackoff and MaxBackoff
+func RetryBackoff(initial, max time.Duration) func(upload.OptionsRetry) {
+	return func(o upload.OptionsRetry) {
+		o.SetInitialBackoff(initial)
+		o.SetMaxBackoff(max)
+	}
+}
+
+// RetryMultiplier returns a function to modify retry Multiplier
+func RetryMultiplier(m float64) func(upload.OptionsRetry) {
+	return func(o upload.OptionsRetry) {
+		o.SetMultiplier(m)
+	}
+}
+
+// RetryJitter returns a function to modify retry Jitter
+func RetryJitter(j float64) func(upload.OptionsRetry) {
+	return func(o upload.OptionsRetry) {
+		o.SetJitter(j)
+	}
+}
+
+// RetryClassifier returns a function to modify retry Classifier
+func RetryClassifier(fn func(error) bool) func(upload.OptionsRetry) {
+	return func(o upload.OptionsRetry) {
+		o.SetClassifier(fn)
+	}
+}
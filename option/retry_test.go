@@ -0,0 +1,55 @@
+package option_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/option"
+)
+
+func TestEvaluateRetryOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []func(upload.OptionsRetry)
+		want upload.OptionsRetry
+	}{
+		{"empty", []func(upload.OptionsRetry){}, option.NewRetry()},
+		{"nil", nil, option.NewRetry()},
+		{"max_attempts", []func(upload.OptionsRetry){option.RetryMaxAttempts(3)}, option.NewRetry().SetMaxAttempts(3)},
+		{"backoff", []func(upload.OptionsRetry){option.RetryBackoff(time.Second, time.Minute)}, option.NewRetry().SetInitialBackoff(time.Second).SetMaxBackoff(time.Minute)},
+		{"multiplier", []func(upload.OptionsRetry){option.RetryMultiplier(1.5)}, option.NewRetry().SetMultiplier(1.5)},
+		{"jitter", []func(upload.OptionsRetry){option.RetryJitter(0)}, option.NewRetry().SetJitter(0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := option.EvaluateRetryOptions(tt.opts...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EvaluateRetryOptions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultClassifier(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"generic", errors.New("storage unavailable"), true},
+		{"canceled", context.Canceled, false},
+		{"deadline", fmt.Errorf("put: %w", context.DeadlineExceeded), false},
+		{"invalid_image", fmt.Errorf("decode: %w", upload.ErrInvalidImage), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := option.DefaultClassifier(tt.err); got != tt.want {
+				t.Errorf("DefaultClassifier() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
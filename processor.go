@@ -1,5 +1,7 @@
 package upload
 
+import "context"
+
 // Processor represents a generic file processor (SMI)
 type Processor interface {
 	// Upload accepts an uploaded file and
@@ -7,6 +9,13 @@ type Processor interface {
 	Process(Uploaded, bool) (Job, error)
 }
 
+// ContextProcessor represents a processor whose jobs can be cancelled
+type ContextProcessor interface {
+	Processor
+	// ProcessContext accepts an uploaded file processed until ctx is done
+	ProcessContext(context.Context, Uploaded, bool) (Job, error)
+}
+
 // ImageProcessor represents an image processor
 type ImageProcessor interface {
 	Processor
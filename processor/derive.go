@@ -0,0 +1,85 @@
+package processor
+
+import (
+	"image"
+	"math"
+	"sort"
+
+	"go.lsl.digital/lardwaz/upload"
+)
+
+// deriveFactor is how much larger than needed a format must be for another format to be resized from it
+const deriveFactor = 2
+
+// plan sorts formats from the largest and returns the index of the format each one is resized from, -1 for the original.
+// A format is resized from the smallest larger format at least deriveFactor times as large as needed.
+func plan(formats []upload.OptionsFormat, config image.Config) []int {
+	sort.SliceStable(formats, func(i, j int) bool {
+		si, sj := scale(formats[i], config), scale(formats[j], config)
+		if si != sj {
+			return si > sj
+		}
+		return formats[i].Name() < formats[j].Name()
+	})
+
+	sources := make([]int, len(formats))
+	for i, format := range formats {
+		sources[i] = -1
+
+		needed := scale(format, config)
+		for j := 0; j < i; j++ {
+			s := scale(formats[j], config)
+			if !derivable(formats[j]) || s >= 1 || s < needed*deriveFactor {
+				continue
+			}
+			// Smaller sources are cheaper to resize from
+			if sources[i] < 0 || s < scale(formats[sources[i]], config) {
+				sources[i] = j
+			}
+		}
+	}
+
+	return sources
+}
+
+// scale returns the ratio between the dimensions of format and those of the original, 1 when not downscaled
+func scale(format upload.OptionsFormat, config image.Config) float64 {
+	if config.Width <= 0 || config.Height <= 0 {
+		return 1
+	}
+
+	sw := float64(format.Width()) / float64(config.Width)
+	sh := float64(format.Height()) / float64(config.Height)
+
+	var s float64
+	switch {
+	case backdropped(format, config):
+		s = math.Min(sw, sh)
+	case format.Width() <= 0:
+		s = sh
+	case format.Height() <= 0:
+		s = sw
+	default:
+		s = math.Max(sw, sh)
+	}
+
+	if s <= 0 || s > 1 {
+		return 1
+	}
+	return s
+}
+
+// derivable checks if other formats may be resized from format, its image being the original resized only
+func derivable(format upload.OptionsFormat) bool {
+	return (format.Width() <= 0) != (format.Height() <= 0) &&
+		(format.Backdrop() == nil || format.Backdrop().Path() == "") &&
+		(format.Watermark() == nil || format.Watermark().Path() == "") &&
+		len(format.Steps()) == 0
+}
+
+// backdropped checks if format is downscaled onto its backdrop rather than cropped or resized
+func backdropped(format upload.OptionsFormat, config image.Config) bool {
+	landscape := config.Height < config.Width
+
+	return format.Backdrop() != nil && format.Backdrop().Path() != "" && !landscape
+}
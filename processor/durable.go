@@ -0,0 +1,148 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/file"
+	"go.lsl.digital/lardwaz/upload/job"
+)
+
+// DurableMaxFailures is the number of times a job recorded by Durable may fail before it is no longer replayed
+const DurableMaxFailures = 5
+
+// Durable is a processor recording the jobs of another processor in a queue until all their formats are written.
+// Jobs interrupted by a crash or failing are replayed by Replay, up to DurableMaxFailures failures.
+type Durable struct {
+	queue     upload.Queue
+	name      string
+	processor upload.Processor
+	options   upload.Options
+}
+
+// NewDurable returns a new Durable recording the jobs of processor in queue under name.
+// name identifies the processing options of processor among the processors sharing queue
+// and opts are the upload options of processed files, used to find them again on Replay.
+// Only name is recorded: jobs pending under a name are replayed with the options of processor at the time of Replay.
+func NewDurable(queue upload.Queue, name string, processor upload.Processor, opts upload.Options) *Durable {
+	return &Durable{
+		queue:     queue,
+		name:      name,
+		processor: processor,
+		options:   opts,
+	}
+}
+
+// Process records then processes file
+func (d *Durable) Process(file upload.Uploaded, validate bool) (upload.Job, error) {
+	return d.ProcessContext(context.Background(), file, validate)
+}
+
+// ProcessContext records then processes file until ctx is done.
+// The job stays pending in the queue unless it succeeds or file is rejected.
+func (d *Durable) ProcessContext(ctx context.Context, file upload.Uploaded, validate bool) (upload.Job, error) {
+	queued, err := d.queue.Push(upload.QueuedJob{
+		Processor: d.name,
+		DiskPath:  file.DiskPath(),
+		URLPath:   file.URLPath(),
+		Validate:  validate,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d.run(ctx, queued, file)
+}
+
+// Replay processes again the pending jobs recorded under the name of d.
+// Jobs that failed DurableMaxFailures times are left pending, for inspection, but not processed.
+func (d *Durable) Replay(ctx context.Context) ([]upload.Job, error) {
+	pending, err := d.queue.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []upload.Job
+	for _, queued := range pending {
+		if queued.Processor != d.name || queued.Failures >= DurableMaxFailures {
+			continue
+		}
+
+		j, err := d.run(ctx, queued, file.NewExisting(queued.DiskPath, queued.URLPath, d.options))
+		if err != nil {
+			log.Printf("error replaying job of %v: %v\n", queued.DiskPath, err)
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+
+	return jobs, ctx.Err()
+}
+
+// run processes file then marks the job queued done once all formats are written
+func (d *Durable) run(ctx context.Context, queued upload.QueuedJob, file upload.Uploaded) (upload.Job, error) {
+	var (
+		processing upload.Job
+		err        error
+	)
+	if processor, ok := d.processor.(upload.ContextProcessor); ok {
+		processing, err = processor.ProcessContext(ctx, file, queued.Validate)
+	} else {
+		processing, err = d.processor.Process(file, queued.Validate)
+	}
+	if err != nil {
+		// Rejected files never get processed
+		if !temporary(err) {
+			d.done(queued)
+		}
+		return nil, err
+	}
+
+	j := job.NewGeneric(file)
+	j.SetRunning()
+
+	go func() {
+		err := follow(processing)
+		switch {
+		case err == nil:
+			d.done(queued)
+		case !temporary(err):
+			d.failed(queued, err)
+		}
+
+		mirror(j, processing, err)
+	}()
+
+	return j, nil
+}
+
+// done removes queued from pending jobs
+func (d *Durable) done(queued upload.QueuedJob) {
+	if err := d.queue.Done(queued.ID); err != nil {
+		log.Printf("error marking job of %v done: %v\n", queued.DiskPath, err)
+	}
+}
+
+// failed records the failure of queued with err
+func (d *Durable) failed(queued upload.QueuedJob, err error) {
+	queued.Failures++
+	queued.Err = err.Error()
+
+	if _, err := d.queue.Push(queued); err != nil {
+		log.Printf("error recording failure of job of %v: %v\n", queued.DiskPath, err)
+	}
+
+	if queued.Failures >= DurableMaxFailures {
+		log.Printf("job of %v failed %d times, no longer replayed: %v\n", queued.DiskPath, queued.Failures, queued.Err)
+	}
+}
+
+// temporary checks if a job rejected or stopped with err may succeed later
+func temporary(err error) bool {
+	return errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, upload.ErrQueueFull) ||
+		errors.Is(err, upload.ErrProcessorClosed)
+}
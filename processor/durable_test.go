@@ -0,0 +1,233 @@
+package processor_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/option"
+	"go.lsl.digital/lardwaz/upload/processor"
+	"go.lsl.digital/lardwaz/upload/queue"
+	"go.lsl.digital/lardwaz/upload/storage"
+	utypes "go.lsl.digital/lardwaz/upload/types"
+	"go.lsl.digital/lardwaz/upload/uploader"
+)
+
+func newQueue(t *testing.T) (*queue.File, func()) {
+	t.Helper()
+
+	root, err := ioutil.TempDir("", "upload")
+	if err != nil {
+		t.Fatalf("TempDir() error = %v", err)
+	}
+
+	q, err := queue.NewFile(filepath.Join(root, "jobs.log"))
+	if err != nil {
+		os.RemoveAll(root)
+		t.Fatalf("NewFile() error = %v", err)
+	}
+
+	return q, func() {
+		q.Close()
+		os.RemoveAll(root)
+	}
+}
+
+func pending(t *testing.T, q upload.Queue) int {
+	t.Helper()
+
+	jobs, err := q.Pending()
+	if err != nil {
+		t.Fatalf("Pending() error = %v", err)
+	}
+
+	return len(jobs)
+}
+
+func TestDurable(t *testing.T) {
+	content, err := ioutil.ReadFile(filepath.Join(testDataFolder, "normal.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	thumb := option.Formats(option.FormatName("thumb"), option.FormatWidth(50), option.FormatHeight(50))
+
+	t.Run("succeeded", func(t *testing.T) {
+		q, cleanup := newQueue(t)
+		defer cleanup()
+
+		u := uploader.NewImage(option.Storage(storage.NewMemory()), option.FileType(utypes.TypeJPEG))
+		p := processor.NewDurable(q, "thumbs", processor.NewImage(thumb), u.Options)
+
+		uploaded, err := u.Upload("normal.jpg", content)
+		if err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+
+		j, err := p.Process(uploaded, true)
+		if err != nil {
+			t.Fatalf("Process() error = %v", err)
+		}
+		if err := waitJob(t, j); err != nil {
+			t.Fatalf("job failed: %v", err)
+		}
+
+		if n := pending(t, q); n != 0 {
+			t.Errorf("pending jobs = %d, want %d", n, 0)
+		}
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		q, cleanup := newQueue(t)
+		defer cleanup()
+
+		u := uploader.NewImage(option.Storage(failingStorage{storage.NewMemory(), "-thumb"}), option.FileType(utypes.TypeJPEG))
+		p := processor.NewDurable(q, "thumbs", processor.NewImage(thumb), u.Options)
+
+		uploaded, err := u.Upload("normal.jpg", content)
+		if err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+
+		j, err := p.Process(uploaded, true)
+		if err != nil {
+			t.Fatalf("Process() error = %v", err)
+		}
+		if err := waitJob(t, j); err == nil {
+			t.Fatal("job should have failed")
+		}
+
+		// Kept for a later replay, along with the failure
+		jobs, err := q.Pending()
+		if err != nil {
+			t.Fatalf("Pending() error = %v", err)
+		}
+		if len(jobs) != 1 || jobs[0].Failures != 1 || jobs[0].Err == "" {
+			t.Errorf("pending jobs = %+v, want 1 job failed once", jobs)
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		q, cleanup := newQueue(t)
+		defer cleanup()
+
+		u := uploader.NewImage(option.Storage(storage.NewMemory()), option.FileType(utypes.TypeJPEG))
+		p := processor.NewDurable(q, "thumbs", processor.NewImage(option.MinWidth(5000), thumb), u.Options)
+
+		uploaded, err := u.Upload("normal.jpg", content)
+		if err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+
+		if _, err := p.Process(uploaded, true); err == nil {
+			t.Fatal("Process() should have failed")
+		}
+
+		if n := pending(t, q); n != 0 {
+			t.Errorf("pending jobs = %d, want %d", n, 0)
+		}
+	})
+}
+
+func TestDurableReplay(t *testing.T) {
+	q, cleanup := newQueue(t)
+	defer cleanup()
+
+	memStorage := storage.NewMemory()
+	u := uploader.NewImage(option.Storage(memStorage), option.FileType(utypes.TypeJPEG))
+
+	content, err := ioutil.ReadFile(filepath.Join(testDataFolder, "normal.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploaded, err := u.Upload("normal.jpg", content)
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	// The process died after recording the job, before writing any format
+	if _, err := q.Push(upload.QueuedJob{Processor: "thumbs", DiskPath: uploaded.DiskPath(), URLPath: uploaded.URLPath(), Validate: true}); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	if _, err := q.Push(upload.QueuedJob{Processor: "others", DiskPath: uploaded.DiskPath(), URLPath: uploaded.URLPath()}); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+
+	p := processor.NewDurable(q, "thumbs", processor.NewImage(option.Formats(option.FormatName("thumb"), option.FormatWidth(50), option.FormatHeight(50))), u.Options)
+
+	jobs, err := p.Replay(context.Background())
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("Replay() jobs = %d, want %d", len(jobs), 1)
+	}
+	if err := waitJob(t, jobs[0]); err != nil {
+		t.Fatalf("job failed: %v", err)
+	}
+
+	if _, ok := memStorage.Bytes(uploaded.DiskPath() + "-thumb"); !ok {
+		t.Errorf("format %s not written", uploaded.DiskPath()+"-thumb")
+	}
+
+	// Jobs of other processors are left alone
+	if n := pending(t, q); n != 1 {
+		t.Errorf("pending jobs = %d, want %d", n, 1)
+	}
+
+	if !bytes.Equal(jobs[0].File().Content(), content) {
+		t.Errorf("replayed file content differs from upload")
+	}
+}
+
+func TestDurableReplayFailing(t *testing.T) {
+	q, cleanup := newQueue(t)
+	defer cleanup()
+
+	content, err := ioutil.ReadFile(filepath.Join(testDataFolder, "normal.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := uploader.NewImage(option.Storage(failingStorage{storage.NewMemory(), "-thumb"}), option.FileType(utypes.TypeJPEG))
+	p := processor.NewDurable(q, "thumbs", processor.NewImage(option.Formats(option.FormatName("thumb"), option.FormatWidth(50), option.FormatHeight(50))), u.Options)
+
+	uploaded, err := u.Upload("normal.jpg", content)
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	j, err := p.Process(uploaded, true)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	waitJob(t, j)
+
+	// Replayed until it failed DurableMaxFailures times
+	replays := 0
+	for ; replays < 2*processor.DurableMaxFailures; replays++ {
+		jobs, err := p.Replay(context.Background())
+		if err != nil {
+			t.Fatalf("Replay() error = %v", err)
+		}
+		if len(jobs) == 0 {
+			break
+		}
+		for _, j := range jobs {
+			waitJob(t, j)
+		}
+	}
+	if replays != processor.DurableMaxFailures-1 {
+		t.Errorf("replays = %d, want %d", replays, processor.DurableMaxFailures-1)
+	}
+
+	// Left pending for inspection
+	if n := pending(t, q); n != 1 {
+		t.Errorf("pending jobs = %d, want %d", n, 1)
+	}
+}
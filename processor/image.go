@@ -2,21 +2,22 @@ package processor
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"image"
-	"image/color"
 	"image/gif"
 	"image/jpeg"
 	"image/png"
 	"log"
-	"os"
+	"path"
+	"sync"
 
 	"github.com/disintegration/imaging"
 	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/exif"
 	"go.lsl.digital/lardwaz/upload/job"
 	"go.lsl.digital/lardwaz/upload/option"
-	"go.lsl.digital/lardwaz/upload/processor/box"
-	"go.lsl.digital/lardwaz/upload/processor/position"
+	"go.lsl.digital/lardwaz/upload/processor/step"
 	utypes "go.lsl.digital/lardwaz/upload/types"
 )
 
@@ -26,6 +27,11 @@ func init() {
 	image.RegisterFormat("gif", "gif", gif.Decode, gif.DecodeConfig)
 }
 
+// duplicate represents an uploaded file whose content was already stored
+type duplicate interface {
+	Duplicate() bool
+}
+
 // Image implements the processor interface
 type Image struct {
 	options upload.OptionsImage
@@ -48,9 +54,19 @@ func (p Image) Options() upload.OptionsImage {
 
 // Process adds a job to process an image based on specific options
 func (p *Image) Process(file upload.Uploaded, validate bool) (upload.Job, error) {
+	return p.ProcessContext(context.Background(), file, validate)
+}
+
+// ProcessContext adds a job to process an image based on specific options, stopped once ctx is done.
+// Formats already written by a stopped job are deleted and ctx.Err() is sent on Job.Failed.
+func (p *Image) ProcessContext(ctx context.Context, file upload.Uploaded, validate bool) (upload.Job, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	content := file.Content()
 	if !utypes.IsValidImage(content) {
-		return nil, fmt.Errorf("image type invalid")
+		return nil, upload.ErrInvalidImage
 	}
 
 	config, _, err := image.DecodeConfig(bytes.NewReader(content))
@@ -59,182 +75,346 @@ func (p *Image) Process(file upload.Uploaded, validate bool) (upload.Job, error)
 		return nil, err
 	}
 
+	// Images are processed upright, transposed by orientations 5 to 8
+	orientation := exif.Orientation(content)
+	if orientation >= 5 {
+		config.Width, config.Height = config.Height, config.Width
+	}
+
 	// Check min width and height
 	if validate && p.Options().MinWidth() != option.NoLimit && config.Width < p.Options().MinWidth() {
 		log.Printf("image %v lower than min width: %v\n", file.DiskPath(), p.Options().MinWidth())
-		return nil, fmt.Errorf("image width less than %dpx", p.Options().MinWidth())
+		return nil, fmt.Errorf("%w: width less than %dpx", upload.ErrImageTooSmall, p.Options().MinWidth())
 	}
 
 	if validate && p.Options().MinHeight() != option.NoLimit && config.Height < p.Options().MinHeight() {
 		log.Printf("image %v lower than min height: %v\n", file.DiskPath(), p.Options().MinHeight())
-		return nil, fmt.Errorf("image height less than %dpx", p.Options().MinHeight())
+		return nil, fmt.Errorf("%w: height less than %dpx", upload.ErrImageTooSmall, p.Options().MinHeight())
 	}
 
 	job := job.NewGeneric(file)
 
-	go p.process(job, &config)
+	go p.process(ctx, job, content, &config, orientation)
 
 	return job, nil
 }
 
-func (p *Image) process(job upload.Job, config *image.Config) {
-	var (
-		img image.Image
-		err error
+// formatOutcome is the outcome of generating a format
+type formatOutcome struct {
+	result  upload.FormatResult
+	ran     bool // false when stopped before completion
+	written bool
+	image   image.Image // generated image, kept when other formats derive from it
+}
 
-		isPROD = p.Options().IsPROD()
-	)
+// process generates the formats of job from content decoded and oriented once, FormatConcurrency formats at a time
+func (p *Image) process(ctx context.Context, job upload.Job, content []byte, config *image.Config, orientation int) {
+	job.SetRunning()
 
+	// The decoded image is shared read-only by all formats
+	src, err := decode(ctx, content, orientation)
+	if err != nil {
+		log.Printf("Image error: %v\n", err)
+		job.SetFailed(err)
+		p.emit(upload.Event{Type: upload.EventJobFailed, File: job.File(), Job: job, Err: err})
+		return
+	}
+
+	var formats []upload.OptionsFormat
 	p.Options().Formats().Each(func(name string, format upload.OptionsFormat) {
-		if format.Name() == "" {
-			return
+		if format.Name() != "" {
+			formats = append(formats, format)
 		}
+	})
 
-		imgDiskPath := job.File().DiskPath()
+	// Formats resized from another one wait for it, -1 for the original
+	sources := make([]int, len(formats))
+	for i := range sources {
+		sources[i] = -1
+	}
+	if p.Options().DeriveFormats() {
+		sources = plan(formats, *config)
+	}
 
-		img, err = imaging.Open(imgDiskPath)
-		if err != nil {
-			log.Printf("Image error: %v\n", err)
-			return
-		}
+	concurrency := p.Options().FormatConcurrency()
+	if concurrency < 1 {
+		concurrency = 1
+	}
 
-		// Prepare metra for processing
-		newWidth := format.Width()
-		newHeight := format.Height()
+	var (
+		outcomes = make([]formatOutcome, len(formats))
+		done     = make([]chan struct{}, len(formats))
+		slots    = make(chan struct{}, concurrency)
+		wg       sync.WaitGroup
+	)
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
 
-		// Do not upscale
-		if format.Width() > config.Width {
-			newWidth = config.Width
+formats:
+	for i, format := range formats {
+		// Stop between formats once cancelled
+		select {
+		case <-ctx.Done():
+			break formats
+		case slots <- struct{}{}:
 		}
-		if format.Height() > config.Height {
-			newHeight = config.Height
+
+		wg.Add(1)
+		go func(i int, format upload.OptionsFormat) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			defer close(done[i])
+
+			// Sources come first, so they are already running
+			from, source := src, ""
+			if j := sources[i]; j >= 0 {
+				<-done[j]
+				if outcomes[j].image != nil {
+					from, source = outcomes[j].image, formats[j].Name()
+				}
+			}
+
+			outcomes[i] = p.format(ctx, job.File(), from, config, format, derivable(format))
+			if outcomes[i].ran {
+				outcomes[i].result.Source = source
+			}
+			if outcomes[i].ran && outcomes[i].result.Err == nil {
+				p.emit(upload.Event{Type: upload.EventFormatGenerated, File: job.File(), Job: job, Format: outcomes[i].result})
+			}
+		}(i, format)
+	}
+	wg.Wait()
+
+	var (
+		results []upload.FormatResult
+		failed  error
+	)
+
+	ctxErr := ctx.Err()
+	for _, outcome := range outcomes {
+		if !outcome.ran {
+			continue
 		}
 
-		// -1 pixel size does not exist
-		if format.Width() < 0 {
-			newWidth = 0
+		result := outcome.result
+		if ctxErr != nil && outcome.written {
+			// Do not leave a partial set of formats behind
+			if err := job.File().Storage().Delete(result.Path); err != nil {
+				log.Printf("Image delete format error: %v", err)
+			}
+			result.Err = ctxErr
 		}
-		if format.Height() < 0 {
-			newHeight = 0
+		if result.Err != nil && failed == nil {
+			failed = result.Err
 		}
+		results = append(results, result)
+	}
+	if ctxErr != nil {
+		failed = ctxErr
+	}
 
-		landscape := config.Height < config.Width
-		preserveAspect := newWidth <= 0 || newHeight <= 0
+	for _, result := range results {
+		job.AddFormat(result)
+	}
 
-		// Do not crop and resize when using backdrop but downscale
-		if format.Backdrop() != nil && format.Backdrop().Path() != "" && !landscape {
-			diskPathBackdrop := format.Backdrop().Path()
-			// Scale down srcImage to fit the bounding box
-			img = imaging.Fit(img, newWidth, newHeight, imaging.Lanczos)
-
-			// Open a new image to use as backdrop layer
-			var back image.Image
-			if !isPROD {
-				back, err = imaging.Open(diskPathBackdrop + "-" + format.Name())
-			} else {
-				var staticAsset *os.File
-				staticAsset, err = box.Asset.Open(diskPathBackdrop + "-" + format.Name())
-				if err != nil {
-					// if err, fall back to a blue background backdrop
-					back = imaging.New(format.Width(), format.Height(), color.NRGBA{0, 29, 56, 0})
-				}
-				defer staticAsset.Close()
-				back, _, err = image.Decode(staticAsset)
-			}
+	if failed != nil {
+		job.SetFailed(failed)
+		p.emit(upload.Event{Type: upload.EventJobFailed, File: job.File(), Job: job, Err: failed})
+		return
+	}
 
-			if err != nil {
-				// if err, fall back to a blue background backdrop
-				back = imaging.New(format.Width(), format.Height(), color.NRGBA{0, 29, 56, 0})
-			} else {
-				// Resize and crop backdrop accordingly
-				back = imaging.Fill(back, format.Width(), format.Height(), imaging.Center, imaging.Lanczos)
-			}
+	job.SetDone()
+	p.emit(upload.Event{Type: upload.EventJobDone, File: job.File(), Job: job})
+}
+
+// decode returns the image of content, rotated and flipped upright according to its EXIF orientation
+func decode(ctx context.Context, content []byte, orientation int) (image.Image, error) {
+	img, err := imaging.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	frame := &upload.Frame{Image: img, Orientation: orientation}
+	if err := (step.AutoOrient{}).Apply(ctx, frame); err != nil {
+		return nil, err
+	}
+	return frame.Image, nil
+}
+
+// emit sends e to the Events of the processor, if any
+func (p *Image) emit(e upload.Event) {
+	if events := p.Options().Events(); events != nil {
+		events.Emit(e)
+	}
+}
+
+// format generates format of file from src, retrying failures. The generated image is kept if keep is set.
+func (p *Image) format(ctx context.Context, file upload.Uploaded, src image.Image, config *image.Config, format upload.OptionsFormat, keep bool) formatOutcome {
+	result := upload.FormatResult{
+		Name: format.Name(),
+		Path: file.DiskPath() + format.Suffix(),
+		URL:  file.URLPath() + format.Suffix(),
+	}
 
-			// Overlay image in center on backdrop layer
-			img = imaging.OverlayCenter(back, img, 1.0)
-		} else if preserveAspect {
-			// Resize srcImage to proper width or height preserving the aspect ratio.
-			img = imaging.Resize(img, newWidth, newHeight, imaging.Lanczos)
-		} else {
-			// Resize and crop the image to fill the [newWidth x newHeight] area
-			img = imaging.Fill(img, newWidth, newHeight, imaging.Center, imaging.Lanczos)
+	// Formats of a duplicate file are reused
+	if dup, ok := file.(duplicate); ok && dup.Duplicate() {
+		if info, err := file.Storage().Stat(result.Path); err == nil {
+			result.Size = info.Size()
+			return formatOutcome{result: result, ran: true}
 		}
+	}
 
-		if format.Watermark() != nil && format.Watermark().Path() != "" {
-			diskPathWatermark := format.Watermark().Path()
-			var watermark image.Image
-			if !isPROD {
-				watermark, err = imaging.Open(diskPathWatermark + "-" + format.Name())
-			} else {
-				var staticAsset *os.File
-				staticAsset, err = box.Asset.Open(diskPathWatermark + "-" + format.Name())
-				if err != nil {
-					log.Printf("Watermark not found: %v", err)
-					return
-				}
-				defer staticAsset.Close()
-				watermark, _, err = image.Decode(staticAsset)
-			}
-			if err == nil {
-				bgBounds := img.Bounds()
-				bgW := bgBounds.Dx()
-				bgH := bgBounds.Dy()
-
-				watermarkBounds := watermark.Bounds()
-				watermarkW := watermarkBounds.Dx()
-				watermarkH := watermarkBounds.Dy()
-
-				var watermarkPos image.Point
-
-				switch format.Watermark().Horizontal() {
-				default:
-					format.Watermark().SetHorizontal(position.Left)
-					fallthrough
-				case position.Left:
-					watermarkPos.X += format.Watermark().OffsetX()
-				case position.Right:
-					RightX := bgBounds.Min.X + bgW - watermarkW
-					watermarkPos.X = RightX - format.Watermark().OffsetX()
-				case position.Center:
-					CenterX := bgBounds.Min.X + bgW/2
-					watermarkPos.X = CenterX - watermarkW/2 + format.Watermark().OffsetX()
-				}
+	var img image.Image
+	attempts, err := retry(ctx, p.Options().Retry(), func() (err error) {
+		img, err = p.generate(ctx, file, src, config, format, &result)
+		return err
+	})
+	result.Attempts = attempts
 
-				switch format.Watermark().Vertical() {
-				default:
-					format.Watermark().SetVertical(position.Top)
-					fallthrough
-				case position.Top:
-					watermarkPos.Y += format.Watermark().OffsetY()
-				case position.Bottom:
-					BottomY := bgBounds.Min.Y + bgH - watermarkH
-					watermarkPos.Y = BottomY - format.Watermark().OffsetY()
-				case position.Center:
-					CenterY := bgBounds.Min.Y + bgH/2
-					watermarkPos.Y = CenterY - watermarkH/2 + format.Watermark().OffsetY()
-				}
+	switch {
+	case err == nil:
+		if !keep {
+			img = nil
+		}
+		return formatOutcome{result: result, ran: true, written: true, image: img}
+	case ctx.Err() != nil:
+		// Stopped, not failed
+		return formatOutcome{}
+	default:
+		result.Err = fmt.Errorf("format %s: %w", format.Name(), err)
+		return formatOutcome{result: result, ran: true}
+	}
+}
 
-				img = imaging.Overlay(img, watermark, watermarkPos, 1.0)
-			}
+// generate writes format of file, decoded as src, at result.Path, setting the dimensions and size of result.
+// It returns the generated image.
+func (p *Image) generate(ctx context.Context, file upload.Uploaded, src image.Image, config *image.Config, format upload.OptionsFormat, result *upload.FormatResult) (image.Image, error) {
+	steps, err := p.Pipeline(file, *config, format)
+	if err != nil {
+		log.Printf("Image get format error: %v", err)
+		return nil, err
+	}
+
+	frame := &upload.Frame{File: file, Format: format, Image: src}
+	for _, s := range steps {
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
 
-		imagingFormat, err := imaging.FormatFromFilename(imgDiskPath)
-		if err != nil {
-			log.Printf("Image get format error: %v", err)
-			return
+		if err := s.Apply(ctx, frame); err != nil {
+			log.Printf("Image %s error: %v", s.Name(), err)
+			return nil, fmt.Errorf("%s: %w", s.Name(), err)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result.Width, result.Height = frame.Image.Bounds().Dx(), frame.Image.Bounds().Dy()
+	result.Size = int64(frame.Output.Len())
+
+	if err := file.Storage().Put(result.Path, &frame.Output); err != nil {
+		log.Printf("Image write format error: %v", err)
+		return nil, err
+	}
+	return frame.Image, nil
+}
+
+// Pipeline returns the steps generating format of file whose dimensions are config.
+// Custom steps of format run after the watermark, before encoding, unless placed next to another step.
+func (p *Image) Pipeline(file upload.Uploaded, config image.Config, format upload.OptionsFormat) ([]upload.Step, error) {
+	isPROD := p.Options().IsPROD()
+
+	ext := format.OutputType().Extension
+	if ext == "" {
+		ext = path.Ext(file.DiskPath())
+	}
+
+	encode := step.Encode{
+		Extension:   ext,
+		Lossless:    format.Lossless(),
+		Quality:     format.Quality(),
+		Progressive: format.Progressive(),
+		Compression: format.Compression(),
+		Colors:      format.Colors(),
+		NoDither:    !format.Dither(),
+	}
+	if err := encode.Check(); err != nil {
+		return nil, err
+	}
+
+	steps := []upload.Step{step.Decode{}, step.AutoOrient{}}
+
+	switch {
+	case backdropped(format, config):
+		// Do not crop and resize when using backdrop but downscale
+		steps = append(steps, step.Backdrop{
+			Path:       format.Backdrop().Path() + "-" + format.Name(),
+			Width:      format.Width(),
+			Height:     format.Height(),
+			Resampling: format.Resampling(),
+			PROD:       isPROD,
+		})
+	case format.Width() <= 0 || format.Height() <= 0:
+		steps = append(steps, step.Resize{Width: format.Width(), Height: format.Height(), Resampling: format.Resampling()})
+	default:
+		steps = append(steps, step.Crop{Width: format.Width(), Height: format.Height(), Resampling: format.Resampling()})
+	}
+
+	if format.Watermark() != nil && format.Watermark().Path() != "" {
+		steps = append(steps, step.Watermark{
+			Path:       format.Watermark().Path() + "-" + format.Name(),
+			Horizontal: format.Watermark().Horizontal(),
+			Vertical:   format.Watermark().Vertical(),
+			OffsetX:    format.Watermark().OffsetX(),
+			OffsetY:    format.Watermark().OffsetY(),
+			PROD:       isPROD,
+		})
+	}
+
+	return place(append(steps, encode), format.Steps())
+}
+
+// place inserts custom steps into steps, before encoding unless placed next to another step
+func place(steps, custom []upload.Step) ([]upload.Step, error) {
+	// Anchors of the steps placed after another one, so that those placed after the same step keep their order
+	anchors := make([]string, len(steps))
+
+	for _, s := range custom {
+		placed, ok := s.(upload.Placed)
+		if !ok {
+			placed = upload.Before(step.Encode{}.Name(), s)
 		}
 
-		outputFile, err := os.Create(imgDiskPath + "-" + format.Name())
-		if err != nil {
-			log.Printf("Image get format error: %v", err)
-			return
+		i := indexStep(steps, placed.Anchor)
+		if i < 0 {
+			return nil, fmt.Errorf("no %s step to place %s next to", placed.Anchor, placed.Step.Name())
 		}
-		defer outputFile.Close()
 
-		if err := imaging.Encode(outputFile, img, imagingFormat); err != nil {
-			log.Printf("Image encode format error: %v", err)
+		anchor := ""
+		if placed.After {
+			anchor = placed.Anchor
+			i++
+			for i < len(steps) && anchors[i] == anchor {
+				i++
+			}
 		}
-	})
 
-	job.SetDone()
+		steps = append(steps[:i], append([]upload.Step{placed.Step}, steps[i:]...)...)
+		anchors = append(anchors[:i], append([]string{anchor}, anchors[i:]...)...)
+	}
+
+	return steps, nil
+}
+
+// indexStep returns the index of the first step named name, -1 if none
+func indexStep(steps []upload.Step, name string) int {
+	for i, s := range steps {
+		if s.Name() == name {
+			return i
+		}
+	}
+	return -1
 }
@@ -2,21 +2,37 @@ package processor_test
 
 // Basic imports
 import (
+	"bytes"
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
 	"io/ioutil"
-	"os"
+	"math/rand"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/disintegration/imaging"
 	"github.com/stretchr/testify/suite"
 	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/event"
 	"go.lsl.digital/lardwaz/upload/file"
 	"go.lsl.digital/lardwaz/upload/option"
 	"go.lsl.digital/lardwaz/upload/processor"
 	"go.lsl.digital/lardwaz/upload/processor/box"
 	"go.lsl.digital/lardwaz/upload/processor/position"
+	"go.lsl.digital/lardwaz/upload/processor/step"
+	"go.lsl.digital/lardwaz/upload/storage"
 	utypes "go.lsl.digital/lardwaz/upload/types"
+	"go.lsl.digital/lardwaz/upload/uploader"
 )
 
 const (
@@ -79,6 +95,10 @@ func (s *ProcessorTestSuite) SetupSuite() {
 		{"Backdrop Portrait", "portrait.jpg", "backdropped_portrait_out.jpg", false, processor.NewImage(option.Formats(option.FormatName("back"), option.FormatWidth(200), option.FormatHeight(200), option.FormatBackdrop(backdropOptPath)))},
 		{"PROD Backdrop Portrait", "portrait.jpg", "backdropped_prod_portrait_out.jpg", false, processor.NewImage(option.PROD(), option.Formats(option.FormatName("back"), option.FormatWidth(200), option.FormatHeight(200), option.FormatBackdrop(backdropOptPath)))},
 		{"Backdrop Damaged", "portrait.jpg", "backdropped_portrait_out.jpg", false, processor.NewImage(option.Formats(option.FormatName("damaged"), option.FormatWidth(200), option.FormatHeight(200), option.FormatBackdrop(backdropOptPath)))},
+		{"Quality", "normal.jpg", "quality_normal_out.jpg", false, processor.NewImage(option.Formats(option.FormatName("thumb"), option.FormatWidth(200), option.FormatHeight(200), option.FormatQuality(60)))},
+		{"Progressive", "normal.jpg", "progressive_normal_out.jpg", false, processor.NewImage(option.Formats(option.FormatName("thumb"), option.FormatWidth(200), option.FormatHeight(200), option.FormatProgressive(true)))},
+		{"Best Compression PNG", "normal.png", "compression_normal_out.png", false, processor.NewImage(option.Formats(option.FormatName("thumb"), option.FormatWidth(200), option.FormatHeight(200), option.FormatCompression(option.CompressionBest)))},
+		{"Palette GIF", "normal.png", "palette_normal_out.png", false, processor.NewImage(option.Formats(option.FormatName("thumb"), option.FormatWidth(200), option.FormatHeight(200), option.FormatOutputType(utypes.TypeGIF), option.FormatColors(16), option.FormatDither(false)))},
 	}
 }
 
@@ -96,7 +116,14 @@ func (s *ProcessorTestSuite) TestImageProcess() {
 
 	for _, tt := range s.imageProcessTests {
 		s.Run(tt.name, func() {
-			uploadedFile := file.NewMockGeneric(tt.inputFile, commonOpts...)
+			// Each case gets its own storage seeded with the input file
+			memStorage := storage.NewMemory()
+			uploadedFile := file.NewMockGeneric(tt.inputFile, append(commonOpts, option.Storage(memStorage))...)
+			if err := memStorage.Put(uploadedFile.DiskPath(), bytes.NewReader(uploadedFile.Content())); err != nil {
+				s.Failf("Cannot store input file", "%s: %v", tt.inputFile, err)
+				return
+			}
+
 			job, err := tt.processor.Process(uploadedFile, true)
 			if tt.expectedProcessError && err != nil {
 				// No problemo; we anticipated!
@@ -116,7 +143,8 @@ func (s *ProcessorTestSuite) TestImageProcess() {
 			case <-job.Done():
 			// upload.Job done! We are good!
 
-			case err = <-job.Failed():
+			case <-job.Failed():
+				err = job.Err()
 				// upload.Job failed! Did we expect?
 				if !tt.expectedProcessError {
 					s.Failf("Cannot process file", "%s: %v", job.File().DiskPath(), err)
@@ -127,21 +155,14 @@ func (s *ProcessorTestSuite) TestImageProcess() {
 			formats := tt.processor.Options().Formats()
 
 			formats.Each(func(name string, format upload.OptionsFormat) {
-				fileDiskPath := job.File().DiskPath() + "-" + format.Name()
-				content, err := ioutil.ReadFile(fileDiskPath)
-				if err != nil {
-					s.Failf("Cannot open processed file", "%s: %v", fileDiskPath, err)
+				fileDiskPath := job.File().DiskPath() + format.Suffix()
+				content, ok := memStorage.Bytes(fileDiskPath)
+				if !ok {
+					s.Failf("Cannot open processed file", "%s", fileDiskPath)
 					return
 				}
 
-				defer func() {
-					// Cleanup
-					if err = os.Remove(fileDiskPath); err != nil {
-						// Not a problem!
-					}
-				}()
-
-				expectedFileDiskPath := tt.expectedFile + "-" + format.Name()
+				expectedFileDiskPath := tt.expectedFile + format.Suffix()
 				if *update {
 					if err = ioutil.WriteFile(filepath.Join(testDataFolder, expectedFileDiskPath), content, 0644); err != nil {
 						s.Failf("Cannot update golden file", "%s: %v", expectedFileDiskPath, err)
@@ -162,6 +183,687 @@ func (s *ProcessorTestSuite) TestImageProcess() {
 	}
 }
 
+func (s *ProcessorTestSuite) TestDuplicateFormats() {
+	memStorage := storage.NewMemory()
+	u := uploader.NewImage(option.Storage(memStorage), option.FileType(utypes.TypeJPEG), option.ContentAddressed(2))
+	p := processor.NewImage(option.Formats(option.FormatName("thumb"), option.FormatWidth(200), option.FormatHeight(200)))
+
+	content, err := ioutil.ReadFile(filepath.Join(testDataFolder, "normal.jpg"))
+	s.Require().NoError(err)
+
+	var writes []int
+	for i := 0; i < 2; i++ {
+		uploaded, err := u.Upload("normal.jpg", content)
+		s.Require().NoError(err)
+
+		job, err := p.Process(uploaded, true)
+		s.Require().NoError(err)
+
+		select {
+		case <-job.Done():
+		case <-time.After(3 * time.Second):
+			s.FailNow("Cannot process file", "%s: Timed out!", uploaded.DiskPath())
+		}
+
+		writes = append(writes, memStorage.Writes())
+	}
+
+	// Original and thumb written once
+	s.Equal([]int{2, 2}, writes)
+}
+
+// cancelStorage cancels a context once a format is written
+type cancelStorage struct {
+	*storage.Memory
+	cancel context.CancelFunc
+}
+
+func (c cancelStorage) Put(path string, r io.Reader) error {
+	err := c.Memory.Put(path, r)
+	c.cancel()
+	return err
+}
+
+func (s *ProcessorTestSuite) TestProcessContext() {
+	p := processor.NewImage(
+		option.Formats(option.FormatName("small"), option.FormatWidth(100), option.FormatHeight(100)),
+		option.Formats(option.FormatName("medium"), option.FormatWidth(200), option.FormatHeight(200)),
+	)
+
+	s.Run("cancelled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		uploadedFile := file.NewMockGeneric("normal.jpg", option.Dir(testDataFolder), option.Storage(storage.NewMemory()))
+		_, err := p.ProcessContext(ctx, uploadedFile, true)
+		s.Equal(context.Canceled, err)
+	})
+
+	s.Run("cancelled between formats", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		memStorage := storage.NewMemory()
+		uploadedFile := file.NewMockGeneric("normal.jpg", option.Dir(testDataFolder), option.Storage(cancelStorage{memStorage, cancel}))
+		s.Require().NoError(memStorage.Put(uploadedFile.DiskPath(), bytes.NewReader(uploadedFile.Content())))
+
+		job, err := p.ProcessContext(ctx, uploadedFile, true)
+		s.Require().NoError(err)
+
+		select {
+		case <-job.Done():
+			s.Fail("Job should have been cancelled")
+		case <-job.Failed():
+			s.Equal(context.Canceled, job.Err())
+		case <-time.After(3 * time.Second):
+			s.FailNow("Cannot process file", "%s: Timed out!", uploadedFile.DiskPath())
+		}
+
+		// The format written before cancellation is removed
+		s.Equal([]string{uploadedFile.DiskPath()}, memStorage.Keys())
+	})
+}
+
+// failingStorage fails writing paths ending with suffix
+type failingStorage struct {
+	*storage.Memory
+	suffix string
+}
+
+func (f failingStorage) Put(path string, r io.Reader) error {
+	if strings.HasSuffix(path, f.suffix) {
+		return errors.New("storage unavailable")
+	}
+	return f.Memory.Put(path, r)
+}
+
+func (s *ProcessorTestSuite) TestJobResult() {
+	p := processor.NewImage(
+		option.Formats(option.FormatName("thumb"), option.FormatWidth(200), option.FormatHeight(100)),
+		option.Formats(option.FormatName("broken"), option.FormatWidth(100), option.FormatHeight(100)),
+	)
+
+	memStorage := storage.NewMemory()
+	uploadedFile := file.NewMockGeneric("normal.jpg", option.Dir(testDataFolder), option.MediaPrefixURL("/media/"), option.Storage(failingStorage{memStorage, "-broken"}))
+	s.Require().NoError(memStorage.Put(uploadedFile.DiskPath(), bytes.NewReader(uploadedFile.Content())))
+
+	job, err := p.Process(uploadedFile, true)
+	s.Require().NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := job.Wait(ctx)
+	s.Require().Error(err)
+	s.Contains(err.Error(), "storage unavailable")
+
+	s.Equal(upload.JobPartiallyFailed, result.State)
+	s.Equal(upload.JobPartiallyFailed, job.State())
+	s.False(result.StartedAt.Before(result.QueuedAt))
+	s.False(result.EndedAt.Before(result.StartedAt))
+	s.Require().Len(result.Formats, 2)
+
+	formats := make(map[string]upload.FormatResult)
+	for _, format := range result.Formats {
+		formats[format.Name] = format
+	}
+
+	thumb := formats["thumb"]
+	s.NoError(thumb.Err)
+	s.Equal(uploadedFile.DiskPath()+"-thumb", thumb.Path)
+	s.Equal(uploadedFile.URLPath()+"-thumb", thumb.URL)
+	s.Equal(200, thumb.Width)
+	s.Equal(100, thumb.Height)
+	content, ok := memStorage.Bytes(thumb.Path)
+	s.Require().True(ok)
+	s.Equal(int64(len(content)), thumb.Size)
+
+	s.Error(formats["broken"].Err)
+}
+
+// flakyStorage fails writing paths ending with suffix the first failures times
+type flakyStorage struct {
+	*storage.Memory
+	suffix   string
+	failures *int32
+}
+
+func (f flakyStorage) Put(path string, r io.Reader) error {
+	if strings.HasSuffix(path, f.suffix) && atomic.AddInt32(f.failures, -1) >= 0 {
+		return errors.New("storage unavailable")
+	}
+	return f.Memory.Put(path, r)
+}
+
+func (s *ProcessorTestSuite) TestRetry() {
+	tests := []struct {
+		name         string
+		failures     int32
+		retry        []func(upload.OptionsRetry)
+		wantAttempts int
+		wantErr      bool
+	}{
+		{"no_retry", 1, nil, 1, true},
+		{"recovered", 2, []func(upload.OptionsRetry){option.RetryMaxAttempts(3)}, 3, false},
+		{"exhausted", 5, []func(upload.OptionsRetry){option.RetryMaxAttempts(3)}, 3, true},
+		{"not_retryable", 1, []func(upload.OptionsRetry){
+			option.RetryMaxAttempts(3),
+			option.RetryClassifier(func(error) bool { return false }),
+		}, 1, true},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			retry := append([]func(upload.OptionsRetry){option.RetryBackoff(time.Millisecond, 5*time.Millisecond)}, tt.retry...)
+			p := processor.NewImage(
+				option.Formats(option.FormatName("thumb"), option.FormatWidth(200), option.FormatHeight(100)),
+				option.Retry(retry...),
+			)
+
+			failures := tt.failures
+			memStorage := storage.NewMemory()
+			uploadedFile := file.NewMockGeneric("normal.jpg", option.Dir(testDataFolder), option.Storage(flakyStorage{memStorage, "-thumb", &failures}))
+			s.Require().NoError(memStorage.Put(uploadedFile.DiskPath(), bytes.NewReader(uploadedFile.Content())))
+
+			job, err := p.Process(uploadedFile, true)
+			s.Require().NoError(err)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+
+			result, err := job.Wait(ctx)
+			if tt.wantErr {
+				s.Error(err)
+			} else {
+				s.NoError(err)
+			}
+
+			s.Require().Len(result.Formats, 1)
+			s.Equal(tt.wantAttempts, result.Formats[0].Attempts)
+
+			_, ok := memStorage.Bytes(uploadedFile.DiskPath() + "-thumb")
+			s.Equal(!tt.wantErr, ok)
+		})
+	}
+}
+
+func (s *ProcessorTestSuite) TestCustomSteps() {
+	var applied []string
+	stamp := step.Filter(func(img image.Image) image.Image {
+		applied = append(applied, "stamp")
+		return imaging.Grayscale(img)
+	})
+
+	p := processor.NewImage(
+		option.Formats(option.FormatName("gray"), option.FormatWidth(200), option.FormatHeight(100), option.FormatSteps(stamp)),
+	)
+
+	memStorage := storage.NewMemory()
+	uploadedFile := file.NewMockGeneric("normal.jpg", option.Dir(testDataFolder), option.Storage(memStorage))
+	s.Require().NoError(memStorage.Put(uploadedFile.DiskPath(), bytes.NewReader(uploadedFile.Content())))
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(uploadedFile.Content()))
+	s.Require().NoError(err)
+
+	format, _ := p.Options().Formats().Get("gray")
+	steps, err := p.Pipeline(uploadedFile, config, format)
+	s.Require().NoError(err)
+
+	var names []string
+	for _, st := range steps {
+		names = append(names, st.Name())
+	}
+	s.Equal([]string{"decode", "auto_orient", "crop", "filter", "encode"}, names)
+
+	job, err := p.Process(uploadedFile, true)
+	s.Require().NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := job.Wait(ctx)
+	s.Require().NoError(err)
+	s.Equal([]string{"stamp"}, applied)
+	s.Require().Len(result.Formats, 1)
+	s.Equal(200, result.Formats[0].Width)
+	s.Equal(100, result.Formats[0].Height)
+
+	content, ok := memStorage.Bytes(result.Formats[0].Path)
+	s.Require().True(ok)
+	img, err := imaging.Decode(bytes.NewReader(content))
+	s.Require().NoError(err)
+
+	// JPEG chroma may drift slightly, channels stay close
+	r, g, b, _ := img.At(100, 50).RGBA()
+	s.InDelta(r>>8, g>>8, 8)
+	s.InDelta(g>>8, b>>8, 8)
+}
+
+func (s *ProcessorTestSuite) TestPlacedSteps() {
+	uploadedFile := file.NewMockGeneric("normal.jpg", option.Dir(testDataFolder), option.Storage(storage.NewMemory()))
+	config, _, err := image.DecodeConfig(bytes.NewReader(uploadedFile.Content()))
+	s.Require().NoError(err)
+
+	tests := []struct {
+		name    string
+		steps   []upload.Step
+		want    []string
+		wantErr bool
+	}{
+		{"default", []upload.Step{markStep("a"), markStep("b")}, []string{"decode", "auto_orient", "crop", "a", "b", "encode"}, false},
+		{"before", []upload.Step{upload.Before("crop", markStep("a"))}, []string{"decode", "auto_orient", "a", "crop", "encode"}, false},
+		{"after", []upload.Step{upload.After("decode", markStep("a")), upload.After("decode", markStep("b"))}, []string{"decode", "a", "b", "auto_orient", "crop", "encode"}, false},
+		{"after encode", []upload.Step{upload.After("encode", markStep("a"))}, []string{"decode", "auto_orient", "crop", "encode", "a"}, false},
+		{"custom anchor", []upload.Step{upload.Before("crop", markStep("a")), upload.After("a", markStep("b")), markStep("c")}, []string{"decode", "auto_orient", "a", "b", "crop", "c", "encode"}, false},
+		{"missing anchor", []upload.Step{upload.After("watermark", markStep("a"))}, nil, true},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			p := processor.NewImage(
+				option.Formats(option.FormatName("thumb"), option.FormatWidth(200), option.FormatHeight(100), option.FormatSteps(tt.steps...)),
+			)
+
+			format, _ := p.Options().Formats().Get("thumb")
+			steps, err := p.Pipeline(uploadedFile, config, format)
+			if tt.wantErr {
+				s.Error(err)
+				return
+			}
+			s.Require().NoError(err)
+
+			var names []string
+			for _, st := range steps {
+				_, placed := st.(upload.Placed)
+				s.False(placed, "placed steps are unwrapped")
+				names = append(names, st.Name())
+			}
+			s.Equal(tt.want, names)
+		})
+	}
+}
+
+// markStep is a custom step named after itself, leaving frames unchanged
+type markStep string
+
+func (m markStep) Name() string {
+	return string(m)
+}
+
+func (markStep) Apply(context.Context, *upload.Frame) error {
+	return nil
+}
+
 func TestProcessorTestSuite(t *testing.T) {
 	suite.Run(t, new(ProcessorTestSuite))
 }
+
+func (s *ProcessorTestSuite) TestFormatConcurrency() {
+	opts := []func(upload.OptionsImage){option.FormatConcurrency(3)}
+	for _, w := range []int{400, 300, 200, 100, 50} {
+		opts = append(opts, option.Formats(option.FormatName(fmt.Sprintf("w%d", w)), option.FormatWidth(w)))
+	}
+	p := processor.NewImage(opts...)
+
+	uploadedFile := newImageFile(s.T(), "image.png", gray(800, 400))
+
+	job, err := p.Process(uploadedFile, true)
+	s.Require().NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := job.Wait(ctx)
+	s.Require().NoError(err)
+	s.Require().Len(result.Formats, 5)
+
+	for _, format := range result.Formats {
+		s.NoError(format.Err)
+		s.Equal(format.Name, fmt.Sprintf("w%d", format.Width))
+		s.Equal(format.Width/2, format.Height)
+
+		_, err := uploadedFile.Storage().Stat(format.Path)
+		s.NoError(err)
+	}
+}
+
+func (s *ProcessorTestSuite) TestDeriveFormats() {
+	formats := []func(upload.OptionsImage){
+		option.Formats(option.FormatName("w800"), option.FormatWidth(800)),
+		option.Formats(option.FormatName("w400"), option.FormatWidth(400)),
+		option.Formats(option.FormatName("w200"), option.FormatWidth(200), option.FormatResampling(option.ResampleCatmullRom)),
+		option.Formats(option.FormatName("h75"), option.FormatHeight(75)),
+		option.Formats(option.FormatName("square"), option.FormatWidth(100), option.FormatHeight(100)),
+		option.Formats(option.FormatName("marked"), option.FormatWidth(500), option.FormatSteps(step.Filter(func(img image.Image) image.Image { return img }))),
+	}
+
+	tests := []struct {
+		name        string
+		derive      bool
+		wantSources map[string]string
+	}{
+		{"original", false, map[string]string{"w800": "", "w400": "", "w200": "", "h75": "", "square": "", "marked": ""}},
+		{"derived", true, map[string]string{"w800": "", "w400": "w800", "w200": "w400", "h75": "w200", "square": "w400", "marked": ""}},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			p := processor.NewImage(append(formats, option.DeriveFormats(tt.derive), option.FormatConcurrency(3))...)
+			uploadedFile := newImageFile(s.T(), "photo.jpg", noise(1000, 750))
+
+			job, err := p.Process(uploadedFile, true)
+			s.Require().NoError(err)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			result, err := job.Wait(ctx)
+			s.Require().NoError(err)
+
+			sources := make(map[string]string)
+			sizes := make(map[string]image.Point)
+			for _, format := range result.Formats {
+				sources[format.Name] = format.Source
+				sizes[format.Name] = image.Pt(format.Width, format.Height)
+			}
+			s.Equal(tt.wantSources, sources)
+
+			// Derived formats have the dimensions of formats resized from the original
+			s.Equal(map[string]image.Point{
+				"w800":   image.Pt(800, 600),
+				"w400":   image.Pt(400, 300),
+				"w200":   image.Pt(200, 150),
+				"h75":    image.Pt(100, 75),
+				"square": image.Pt(100, 100),
+				"marked": image.Pt(500, 375),
+			}, sizes)
+		})
+	}
+}
+
+func (s *ProcessorTestSuite) TestEvents() {
+	bus := event.NewBus(option.DispatchAsync)
+
+	var (
+		mu     sync.Mutex
+		events []upload.Event
+	)
+	record := func(e upload.Event) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}
+	bus.OnFormatGenerated(record)
+	bus.OnJobDone(record)
+	bus.OnJobFailed(record)
+
+	p := processor.NewImage(
+		option.Formats(option.FormatName("thumb"), option.FormatWidth(200), option.FormatHeight(100)),
+		option.Formats(option.FormatName("broken"), option.FormatWidth(100), option.FormatHeight(100)),
+		option.ImageEvents(bus),
+	)
+
+	for _, tt := range []struct {
+		name    string
+		storage upload.Storage
+		want    []upload.EventType
+	}{
+		{"done", storage.NewMemory(), []upload.EventType{upload.EventFormatGenerated, upload.EventFormatGenerated, upload.EventJobDone}},
+		{"failed", failingStorage{storage.NewMemory(), "-broken"}, []upload.EventType{upload.EventFormatGenerated, upload.EventJobFailed}},
+	} {
+		s.Run(tt.name, func() {
+			mu.Lock()
+			events = nil
+			mu.Unlock()
+
+			uploadedFile := file.NewMockGeneric("normal.jpg", option.Dir(testDataFolder), option.Storage(tt.storage))
+
+			job, err := p.Process(uploadedFile, true)
+			s.Require().NoError(err)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+
+			job.Wait(ctx)
+			bus.Wait()
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			var types []upload.EventType
+			for _, e := range events {
+				types = append(types, e.Type)
+				s.Equal(uploadedFile, e.File)
+				s.Equal(job, e.Job)
+			}
+			s.Equal(tt.want, types)
+
+			// Only the formats written are emitted
+			if last := events[len(events)-1]; last.Type == upload.EventJobFailed {
+				s.Contains(last.Err.Error(), "storage unavailable")
+				s.Equal("thumb", events[0].Format.Name)
+			}
+		})
+	}
+}
+
+func (s *ProcessorTestSuite) TestOutputType() {
+	p := processor.NewImage(
+		option.Formats(option.FormatName("thumb"), option.FormatWidth(200), option.FormatHeight(100), option.FormatOutputType(utypes.TypeGIF)),
+		option.Formats(option.FormatName("png"), option.FormatWidth(100), option.FormatOutputType(utypes.TypePNG)),
+		option.Formats(option.FormatName("jpeg"), option.FormatWidth(100)),
+	)
+
+	memStorage := storage.NewMemory()
+	uploadedFile := file.NewMockGeneric("normal.jpg", option.Dir(testDataFolder), option.MediaPrefixURL("/media/"), option.Storage(memStorage))
+
+	job, err := p.Process(uploadedFile, true)
+	s.Require().NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := job.Wait(ctx)
+	s.Require().NoError(err)
+	s.Require().Len(result.Formats, 3)
+
+	wantTypes := map[string]string{"thumb": "gif", "png": "png", "jpeg": "jpeg"}
+	wantSuffixes := map[string]string{"thumb": "-thumb.gif", "png": "-png.png", "jpeg": "-jpeg"}
+	for _, format := range result.Formats {
+		s.Equal(uploadedFile.DiskPath()+wantSuffixes[format.Name], format.Path)
+		s.Equal(uploadedFile.URLPath()+wantSuffixes[format.Name], format.URL)
+
+		content, ok := memStorage.Bytes(format.Path)
+		s.Require().True(ok, format.Path)
+
+		config, typ, err := image.DecodeConfig(bytes.NewReader(content))
+		s.Require().NoError(err)
+		s.Equal(wantTypes[format.Name], typ, format.Name)
+		s.Equal(format.Width, config.Width)
+		s.Equal(format.Height, config.Height)
+	}
+}
+
+func (s *ProcessorTestSuite) TestEncoderSettings() {
+	thumb := func(name string, opts ...func(upload.OptionsFormat)) func(upload.OptionsImage) {
+		return option.Formats(append([]func(upload.OptionsFormat){option.FormatName(name), option.FormatWidth(300)}, opts...)...)
+	}
+	p := processor.NewImage(
+		thumb("jpeg"),
+		thumb("quality", option.FormatQuality(60)),
+		thumb("progressive", option.FormatProgressive(true)),
+		thumb("png", option.FormatOutputType(utypes.TypePNG)),
+		thumb("none", option.FormatOutputType(utypes.TypePNG), option.FormatCompression(option.CompressionNone)),
+		thumb("best", option.FormatOutputType(utypes.TypePNG), option.FormatCompression(option.CompressionBest)),
+		thumb("gif", option.FormatOutputType(utypes.TypeGIF)),
+		thumb("palette", option.FormatOutputType(utypes.TypeGIF), option.FormatColors(16), option.FormatDither(false)),
+	)
+
+	memStorage := storage.NewMemory()
+	uploadedFile := file.NewMockGeneric("normal.jpg", option.Dir(testDataFolder), option.Storage(memStorage))
+
+	job, err := p.Process(uploadedFile, true)
+	s.Require().NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := job.Wait(ctx)
+	s.Require().NoError(err)
+
+	sizes := make(map[string]int64)
+	for _, format := range result.Formats {
+		sizes[format.Name] = format.Size
+	}
+
+	s.Truef(sizes["quality"] < sizes["jpeg"], "JPEG quality 60 (%d) not smaller than the default 95 (%d)", sizes["quality"], sizes["jpeg"])
+	s.Truef(sizes["png"] < sizes["none"], "PNG default compression (%d) not smaller than none (%d)", sizes["png"], sizes["none"])
+	s.Truef(sizes["best"] <= sizes["png"], "PNG best compression (%d) larger than the default (%d)", sizes["best"], sizes["png"])
+	s.Truef(sizes["palette"] < sizes["gif"], "GIF of 16 colors (%d) not smaller than 256 (%d)", sizes["palette"], sizes["gif"])
+
+	// Progressive JPEG have a SOF2 frame header
+	content, ok := memStorage.Bytes(uploadedFile.DiskPath() + "-progressive")
+	s.Require().True(ok)
+	s.True(bytes.Contains(content, []byte{0xff, 0xc2}), "SOF2 marker")
+
+	img, err := jpeg.Decode(bytes.NewReader(content))
+	s.Require().NoError(err)
+	s.Equal(300, img.Bounds().Dx())
+}
+
+func (s *ProcessorTestSuite) TestOrientation() {
+	// Images of every EXIF orientation are red, green / blue, white quadrants of 160x80 once upright
+	p := processor.NewImage(
+		option.MinWidth(160),
+		option.MinHeight(80),
+		option.Formats(option.FormatName("thumb"), option.FormatWidth(80)),
+		option.Formats(option.FormatName("square"), option.FormatWidth(40), option.FormatHeight(40)),
+	)
+	quadrants := []struct {
+		x, y  float64 // Position relative to the size
+		color color.NRGBA
+	}{
+		{0.25, 0.25, color.NRGBA{255, 0, 0, 255}},
+		{0.75, 0.25, color.NRGBA{0, 255, 0, 255}},
+		{0.25, 0.75, color.NRGBA{0, 0, 255, 255}},
+		{0.75, 0.75, color.NRGBA{255, 255, 255, 255}},
+	}
+
+	type test struct {
+		name    string
+		file    string
+		convert bool // Uploaded with ConvertTo PNG, which does not keep EXIF
+	}
+	var tests []test
+	for orientation := 1; orientation <= 8; orientation++ {
+		name := fmt.Sprintf("orientation_%d.jpg", orientation)
+		tests = append(tests, test{name, name, false})
+	}
+	tests = append(tests, test{"converted_to_png", "orientation_6.jpg", true})
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			memStorage := storage.NewMemory()
+
+			var uploadedFile upload.Uploaded = file.NewMockGeneric(tt.file, option.Dir(testDataFolder), option.Storage(memStorage))
+			if tt.convert {
+				content, err := ioutil.ReadFile(filepath.Join(testDataFolder, tt.file))
+				s.Require().NoError(err)
+
+				u := uploader.NewImage(option.Storage(memStorage), option.FileType(utypes.TypeJPEG), option.ConvertTo(utypes.TypeJPEG, utypes.TypePNG))
+				uploadedFile, err = u.Upload(tt.file, content)
+				s.Require().NoError(err)
+			}
+
+			// Validated against the upright dimensions
+			job, err := p.Process(uploadedFile, true)
+			s.Require().NoError(err)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+
+			result, err := job.Wait(ctx)
+			s.Require().NoError(err)
+
+			sizes := map[string]image.Point{"thumb": {80, 40}, "square": {40, 40}}
+			for _, format := range result.Formats {
+				s.Equal(sizes[format.Name], image.Pt(format.Width, format.Height), format.Name)
+			}
+
+			content, ok := memStorage.Bytes(uploadedFile.DiskPath() + "-thumb")
+			s.Require().True(ok)
+			img, _, err := image.Decode(bytes.NewReader(content))
+			s.Require().NoError(err)
+
+			for _, q := range quadrants {
+				got := color.NRGBAModel.Convert(img.At(int(q.x*80), int(q.y*40))).(color.NRGBA)
+				s.Truef(near(got, q.color), "color at %v,%v = %v, want %v", q.x, q.y, got, q.color)
+			}
+		})
+	}
+}
+
+// near checks if the channels of a and b differ by less than JPEG artifacts would
+func near(a, b color.NRGBA) bool {
+	diff := func(x, y uint8) int {
+		if x > y {
+			return int(x - y)
+		}
+		return int(y - x)
+	}
+	return diff(a.R, b.R) < 32 && diff(a.G, b.G) < 32 && diff(a.B, b.B) < 32
+}
+
+// BenchmarkProcess generates 10 formats of a 2000x1500 image. The "per format" baseline generates each
+// format through its own processor, decoding the original once per format.
+func BenchmarkProcess(b *testing.B) {
+	widths := []int{1600, 1200, 1000, 800, 600, 400, 300, 200, 100, 50}
+
+	benchmarks := []struct {
+		name        string
+		concurrency int
+		derive      bool
+		perFormat   bool
+	}{
+		{"per format", 1, false, true},
+		{"sequential", 1, false, false},
+		{"parallel", 4, false, false},
+		{"derived", 1, true, false},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			opts := []func(upload.OptionsImage){option.FormatConcurrency(bm.concurrency), option.DeriveFormats(bm.derive)}
+
+			var processors []*processor.Image
+			for _, w := range widths {
+				format := option.Formats(option.FormatName(fmt.Sprintf("w%d", w)), option.FormatWidth(w))
+				if bm.perFormat {
+					processors = append(processors, processor.NewImage(append(opts, format)...))
+				} else {
+					opts = append(opts, format)
+				}
+			}
+			if !bm.perFormat {
+				processors = append(processors, processor.NewImage(opts...))
+			}
+			uploadedFile := newImageFile(b, "photo.jpg", noise(2000, 1500))
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, p := range processors {
+					job, err := p.Process(uploadedFile, false)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if _, err := job.Wait(context.Background()); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// noise returns a width x height image of random pixels, as costly to encode as a photo
+func noise(width, height int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	rand.New(rand.NewSource(1)).Read(img.Pix)
+	return img
+}
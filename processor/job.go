@@ -0,0 +1,32 @@
+package processor
+
+import "go.lsl.digital/lardwaz/upload"
+
+// follow waits for processing to complete and returns the error it failed with
+func follow(processing upload.Job) error {
+	select {
+	case <-processing.Done():
+	case <-processing.Failed():
+	}
+
+	return processing.Err()
+}
+
+// mirror completes j with the formats of processing and err
+func mirror(j upload.Job, processing upload.Job, err error) {
+	for _, format := range processing.Result().Formats {
+		j.AddFormat(format)
+	}
+
+	finish(j, err)
+}
+
+// finish signals the completion of j
+func finish(j upload.Job, err error) {
+	if err != nil {
+		j.SetFailed(err)
+		return
+	}
+
+	j.SetDone()
+}
@@ -0,0 +1,223 @@
+package processor
+
+import (
+	"context"
+	"image"
+	"sync"
+
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/job"
+	"go.lsl.digital/lardwaz/upload/option"
+)
+
+// bytesPerPixel is the memory taken by a decoded pixel (NRGBA)
+const bytesPerPixel = 4
+
+// Pool is a processor running the jobs of another processor on a bounded number of workers.
+// Errors of the wrapped processor, validation included, are sent on Job.Failed.
+type Pool struct {
+	processor upload.Processor
+	options   upload.OptionsPool
+	queue     chan *poolTask
+	workers   sync.WaitGroup
+
+	// closing guards queue against sends after Close
+	closing sync.RWMutex
+	closed  bool
+
+	// memory is the estimated memory of running jobs
+	memory     int64
+	memoryCond *sync.Cond
+}
+
+// poolTask is a job waiting for a worker
+type poolTask struct {
+	ctx      context.Context
+	file     upload.Uploaded
+	validate bool
+	job      *job.Generic
+	memory   int64
+}
+
+// NewPool returns a new Pool running the jobs of processor
+func NewPool(processor upload.Processor, opts ...func(upload.OptionsPool)) *Pool {
+	options := option.EvaluatePoolOptions(opts...)
+
+	queueDepth := options.QueueDepth()
+	if queueDepth < 0 {
+		queueDepth = 0
+	}
+
+	pool := &Pool{
+		processor:  processor,
+		options:    options,
+		queue:      make(chan *poolTask, queueDepth),
+		memoryCond: sync.NewCond(&sync.Mutex{}),
+	}
+
+	concurrency := options.Concurrency()
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	pool.workers.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go pool.work()
+	}
+
+	return pool
+}
+
+// Options returns OptionsPool
+func (p *Pool) Options() upload.OptionsPool {
+	return p.options
+}
+
+// Process queues a job processing file
+func (p *Pool) Process(file upload.Uploaded, validate bool) (upload.Job, error) {
+	return p.ProcessContext(context.Background(), file, validate)
+}
+
+// ProcessContext queues a job processing file until ctx is done.
+// A full queue blocks, rejects the job with upload.ErrQueueFull or drops the oldest job depending on Backpressure.
+func (p *Pool) ProcessContext(ctx context.Context, file upload.Uploaded, validate bool) (upload.Job, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	task := &poolTask{
+		ctx:      ctx,
+		file:     file,
+		validate: validate,
+		job:      job.NewGeneric(file),
+		memory:   estimateMemory(file),
+	}
+
+	p.closing.RLock()
+	defer p.closing.RUnlock()
+
+	if p.closed {
+		return nil, upload.ErrProcessorClosed
+	}
+
+	switch p.options.Backpressure() {
+	case option.BackpressureReject:
+		select {
+		case p.queue <- task:
+		default:
+			return nil, upload.ErrQueueFull
+		}
+	case option.BackpressureDrop:
+		for queued := false; !queued; {
+			select {
+			case p.queue <- task:
+				queued = true
+			default:
+				// Make room by dropping the oldest job, or this one when nothing waits
+				select {
+				case dropped := <-p.queue:
+					finish(dropped.job, upload.ErrJobDropped)
+				default:
+					finish(task.job, upload.ErrJobDropped)
+					queued = true
+				}
+			}
+		}
+	default:
+		select {
+		case p.queue <- task:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return task.job, nil
+}
+
+// Close stops accepting jobs and waits for queued jobs to be processed
+func (p *Pool) Close() error {
+	p.closing.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.closing.Unlock()
+
+	p.workers.Wait()
+
+	return nil
+}
+
+// work runs queued jobs until the queue is closed
+func (p *Pool) work() {
+	defer p.workers.Done()
+
+	for task := range p.queue {
+		p.run(task)
+	}
+}
+
+// run processes task with the wrapped processor and waits for its completion
+func (p *Pool) run(task *poolTask) {
+	if err := task.ctx.Err(); err != nil {
+		finish(task.job, err)
+		return
+	}
+
+	p.acquire(task.memory)
+	defer p.release(task.memory)
+
+	task.job.SetRunning()
+
+	var (
+		processing upload.Job
+		err        error
+	)
+	if processor, ok := p.processor.(upload.ContextProcessor); ok {
+		processing, err = processor.ProcessContext(task.ctx, task.file, task.validate)
+	} else {
+		processing, err = p.processor.Process(task.file, task.validate)
+	}
+	if err != nil {
+		finish(task.job, err)
+		return
+	}
+
+	mirror(task.job, processing, follow(processing))
+}
+
+// acquire waits until memory fits in MaxMemory, a job alone always fits
+func (p *Pool) acquire(memory int64) {
+	p.memoryCond.L.Lock()
+	defer p.memoryCond.L.Unlock()
+
+	for p.options.MaxMemory() != option.NoLimit && p.memory > 0 && p.memory+memory > p.options.MaxMemory() {
+		p.memoryCond.Wait()
+	}
+	p.memory += memory
+}
+
+// release gives back memory acquired by a job
+func (p *Pool) release(memory int64) {
+	p.memoryCond.L.Lock()
+	p.memory -= memory
+	p.memoryCond.L.Unlock()
+
+	p.memoryCond.Broadcast()
+}
+
+// estimateMemory returns the memory needed to decode file, 0 if it is not an image
+func estimateMemory(file upload.Uploaded) int64 {
+	r, err := file.Storage().Get(file.DiskPath())
+	if err != nil {
+		return 0
+	}
+	defer r.Close()
+
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return 0
+	}
+
+	return int64(config.Width) * int64(config.Height) * bytesPerPixel
+}
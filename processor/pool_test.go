@@ -0,0 +1,282 @@
+package processor_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/file"
+	"go.lsl.digital/lardwaz/upload/job"
+	"go.lsl.digital/lardwaz/upload/option"
+	"go.lsl.digital/lardwaz/upload/processor"
+	"go.lsl.digital/lardwaz/upload/storage"
+)
+
+// blockingProcessor processes files once released, recording how many run at once
+type blockingProcessor struct {
+	release chan struct{}
+	running int32
+	max     int32
+}
+
+func newBlockingProcessor() *blockingProcessor {
+	return &blockingProcessor{release: make(chan struct{})}
+}
+
+func (b *blockingProcessor) Process(file upload.Uploaded, validate bool) (upload.Job, error) {
+	j := job.NewGeneric(file)
+
+	go func() {
+		running := atomic.AddInt32(&b.running, 1)
+		for {
+			max := atomic.LoadInt32(&b.max)
+			if running <= max || atomic.CompareAndSwapInt32(&b.max, max, running) {
+				break
+			}
+		}
+
+		<-b.release
+		atomic.AddInt32(&b.running, -1)
+		j.SetDone()
+	}()
+
+	return j, nil
+}
+
+// waitJob returns the error of j, nil once done
+func waitJob(t *testing.T, j upload.Job) error {
+	t.Helper()
+
+	select {
+	case <-j.Done():
+		return nil
+	case <-j.Failed():
+		return j.Err()
+	case <-time.After(3 * time.Second):
+		t.Fatalf("job %s timed out", j.File().DiskPath())
+		return nil
+	}
+}
+
+// waitRunning waits until n jobs of b run
+func waitRunning(t *testing.T, b *blockingProcessor, n int32) {
+	t.Helper()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for atomic.LoadInt32(&b.running) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("running jobs = %d, want %d", atomic.LoadInt32(&b.running), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// newImageFile returns a file holding img, encoded in the format of the extension of name
+func newImageFile(t testing.TB, name string, img image.Image) upload.Uploaded {
+	t.Helper()
+
+	format, err := imaging.FormatFromFilename(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var content bytes.Buffer
+	if err := imaging.Encode(&content, img, format); err != nil {
+		t.Fatal(err)
+	}
+
+	memStorage := storage.NewMemory()
+	uploaded := file.NewExisting(name, "/"+name, option.EvaluateOptions(option.Storage(memStorage)))
+	if err := memStorage.Put(uploaded.DiskPath(), &content); err != nil {
+		t.Fatal(err)
+	}
+
+	return uploaded
+}
+
+// gray returns a blank width x height image
+func gray(width, height int) image.Image {
+	return image.NewGray(image.Rect(0, 0, width, height))
+}
+
+func TestPoolConcurrency(t *testing.T) {
+	b := newBlockingProcessor()
+	pool := processor.NewPool(b, option.Concurrency(3), option.QueueDepth(20))
+	defer pool.Close()
+
+	var jobs []upload.Job
+	for i := 0; i < 20; i++ {
+		j, err := pool.Process(newImageFile(t, "image.png", gray(10, 10)), true)
+		if err != nil {
+			t.Fatalf("Process() error = %v", err)
+		}
+		jobs = append(jobs, j)
+	}
+
+	waitRunning(t, b, 3)
+	close(b.release)
+
+	for _, j := range jobs {
+		if err := waitJob(t, j); err != nil {
+			t.Errorf("job failed: %v", err)
+		}
+	}
+
+	if max := atomic.LoadInt32(&b.max); max != 3 {
+		t.Errorf("max running jobs = %d, want %d", max, 3)
+	}
+}
+
+func TestPoolBackpressure(t *testing.T) {
+	t.Run("reject", func(t *testing.T) {
+		b := newBlockingProcessor()
+		pool := processor.NewPool(b, option.Concurrency(1), option.QueueDepth(1), option.Backpressure(option.BackpressureReject))
+		defer pool.Close()
+		defer close(b.release)
+
+		if _, err := pool.Process(newImageFile(t, "running.png", gray(10, 10)), true); err != nil {
+			t.Fatalf("Process() error = %v", err)
+		}
+		waitRunning(t, b, 1)
+
+		if _, err := pool.Process(newImageFile(t, "queued.png", gray(10, 10)), true); err != nil {
+			t.Fatalf("Process() error = %v", err)
+		}
+
+		if _, err := pool.Process(newImageFile(t, "rejected.png", gray(10, 10)), true); err != upload.ErrQueueFull {
+			t.Errorf("Process() error = %v, want %v", err, upload.ErrQueueFull)
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		b := newBlockingProcessor()
+		pool := processor.NewPool(b, option.Concurrency(1), option.QueueDepth(1), option.Backpressure(option.BackpressureDrop))
+		defer pool.Close()
+
+		running, err := pool.Process(newImageFile(t, "running.png", gray(10, 10)), true)
+		if err != nil {
+			t.Fatalf("Process() error = %v", err)
+		}
+		waitRunning(t, b, 1)
+
+		oldest, err := pool.Process(newImageFile(t, "oldest.png", gray(10, 10)), true)
+		if err != nil {
+			t.Fatalf("Process() error = %v", err)
+		}
+
+		newest, err := pool.Process(newImageFile(t, "newest.png", gray(10, 10)), true)
+		if err != nil {
+			t.Fatalf("Process() error = %v", err)
+		}
+
+		if err := waitJob(t, oldest); err != upload.ErrJobDropped {
+			t.Errorf("oldest job error = %v, want %v", err, upload.ErrJobDropped)
+		}
+
+		close(b.release)
+
+		for _, j := range []upload.Job{running, newest} {
+			if err := waitJob(t, j); err != nil {
+				t.Errorf("job %s failed: %v", j.File().DiskPath(), err)
+			}
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		b := newBlockingProcessor()
+		pool := processor.NewPool(b, option.Concurrency(1), option.QueueDepth(0))
+		defer pool.Close()
+		defer close(b.release)
+
+		if _, err := pool.Process(newImageFile(t, "running.png", gray(10, 10)), true); err != nil {
+			t.Fatalf("Process() error = %v", err)
+		}
+		waitRunning(t, b, 1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		if _, err := pool.ProcessContext(ctx, newImageFile(t, "blocked.png", gray(10, 10)), true); err != context.DeadlineExceeded {
+			t.Errorf("ProcessContext() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
+
+func TestPoolMaxMemory(t *testing.T) {
+	b := newBlockingProcessor()
+
+	// Room for a single 100x100 image at a time
+	pool := processor.NewPool(b, option.Concurrency(4), option.MaxMemory(100*100*4))
+	defer pool.Close()
+
+	var jobs []upload.Job
+	for i := 0; i < 4; i++ {
+		j, err := pool.Process(newImageFile(t, "image.png", gray(100, 100)), true)
+		if err != nil {
+			t.Fatalf("Process() error = %v", err)
+		}
+		jobs = append(jobs, j)
+	}
+
+	waitRunning(t, b, 1)
+	time.Sleep(20 * time.Millisecond)
+	close(b.release)
+
+	for _, j := range jobs {
+		if err := waitJob(t, j); err != nil {
+			t.Errorf("job failed: %v", err)
+		}
+	}
+
+	if max := atomic.LoadInt32(&b.max); max != 1 {
+		t.Errorf("max running jobs = %d, want %d", max, 1)
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	b := newBlockingProcessor()
+	pool := processor.NewPool(b, option.Concurrency(2))
+
+	var jobs []upload.Job
+	for i := 0; i < 5; i++ {
+		j, err := pool.Process(newImageFile(t, "image.png", gray(10, 10)), true)
+		if err != nil {
+			t.Fatalf("Process() error = %v", err)
+		}
+		jobs = append(jobs, j)
+	}
+
+	close(b.release)
+	pool.Close()
+
+	// Queued jobs are processed before Close returns
+	for _, j := range jobs {
+		if got := j.State(); got != upload.JobSucceeded {
+			t.Errorf("State() = %v, want %v", got, upload.JobSucceeded)
+		}
+	}
+
+	if _, err := pool.Process(newImageFile(t, "image.png", gray(10, 10)), true); err != upload.ErrProcessorClosed {
+		t.Errorf("Process() error = %v, want %v", err, upload.ErrProcessorClosed)
+	}
+}
+
+func TestPoolImage(t *testing.T) {
+	pool := processor.NewPool(processor.NewImage(option.MinWidth(500)))
+	defer pool.Close()
+
+	// Validation errors of the wrapped processor go through the job
+	j, err := pool.Process(newImageFile(t, "small.png", gray(10, 10)), true)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	if err := waitJob(t, j); err == nil {
+		t.Errorf("job should have failed")
+	}
+}
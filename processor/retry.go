@@ -0,0 +1,49 @@
+package processor
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+
+	"go.lsl.digital/lardwaz/upload"
+)
+
+// retry runs fn until it succeeds, fails with a non retryable error, MaxAttempts is reached or ctx is done.
+// It returns the number of attempts made and the last error.
+func retry(ctx context.Context, opts upload.OptionsRetry, fn func() error) (int, error) {
+	retryable := opts.Classifier()
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= opts.MaxAttempts() || ctx.Err() != nil || !retryable(err) {
+			return attempt, err
+		}
+
+		timer := time.NewTimer(backoff(opts, attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		}
+	}
+}
+
+// backoff returns the wait before the attempt following attempt
+func backoff(opts upload.OptionsRetry, attempt int) time.Duration {
+	wait := float64(opts.InitialBackoff()) * math.Pow(opts.Multiplier(), float64(attempt-1))
+	if max := float64(opts.MaxBackoff()); max > 0 && wait > max {
+		wait = max
+	}
+
+	if jitter := opts.Jitter(); jitter > 0 {
+		wait += wait * jitter * (2*rand.Float64() - 1)
+	}
+
+	if wait < 0 {
+		return 0
+	}
+
+	return time.Duration(wait)
+}
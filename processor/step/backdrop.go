@@ -0,0 +1,54 @@
+package step
+
+import (
+	"context"
+	"image"
+	"image/color"
+
+	"github.com/disintegration/imaging"
+	"go.lsl.digital/lardwaz/upload"
+)
+
+// backdropColor is used when the backdrop image cannot be read
+var backdropColor = color.NRGBA{0, 29, 56, 0}
+
+// Backdrop downscales the image to fit Width x Height and centers it on the backdrop image at Path
+type Backdrop struct {
+	Path       string
+	Width      int
+	Height     int
+	Resampling int  // (default: option.ResampleLanczos)
+	PROD       bool // Read Path from the asset box
+}
+
+// Name implements the upload.Step interface
+func (Backdrop) Name() string {
+	return "backdrop"
+}
+
+// Apply implements the upload.Step interface
+func (s Backdrop) Apply(ctx context.Context, frame *upload.Frame) error {
+	img := imaging.Fit(frame.Image, s.Width, s.Height, resampleFilter(s.Resampling))
+
+	back, err := s.open()
+	if err != nil {
+		// Fall back to a blue background
+		back = imaging.New(s.Width, s.Height, backdropColor)
+	} else {
+		back = imaging.Fill(back, s.Width, s.Height, imaging.Center, imaging.Lanczos)
+	}
+
+	frame.Image = imaging.OverlayCenter(back, img, 1.0)
+	return nil
+}
+
+// open decodes the backdrop image
+func (s Backdrop) open() (image.Image, error) {
+	r, err := openAsset(s.Path, s.PROD)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return imaging.Decode(r)
+}
@@ -0,0 +1,33 @@
+package step
+
+import (
+	"context"
+
+	"github.com/disintegration/imaging"
+	"go.lsl.digital/lardwaz/upload"
+	_ "golang.org/x/image/webp" // WebP originals
+)
+
+// Decode decodes the uploaded file, unless the frame already holds an image
+type Decode struct{}
+
+// Name implements the upload.Step interface
+func (Decode) Name() string {
+	return "decode"
+}
+
+// Apply implements the upload.Step interface
+func (Decode) Apply(ctx context.Context, frame *upload.Frame) error {
+	if frame.Image != nil {
+		return nil
+	}
+
+	r, err := frame.File.Storage().Get(frame.File.DiskPath())
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	frame.Image, err = imaging.Decode(r)
+	return err
+}
@@ -0,0 +1,127 @@
+package step
+
+import (
+	"context"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/disintegration/imaging"
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/internal/jpeg"
+	"go.lsl.digital/lardwaz/upload/option"
+)
+
+// Encoder writes img to w with the settings of s
+type Encoder func(w io.Writer, img image.Image, s Encode) error
+
+// Registered encoders by lower case extension
+var (
+	mu       sync.RWMutex
+	encoders = make(map[string]Encoder)
+)
+
+// RegisterEncoder sets the encoder of images of extension, replacing any existing one.
+// Packages such as converter/webp register themselves when imported.
+func RegisterEncoder(extension string, encode Encoder) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	encoders[normalizeExt(extension)] = encode
+}
+
+// Encode encodes the image to the frame output as the type of Extension (jpg, png, gif...),
+// with the encoder registered for Extension if any
+type Encode struct {
+	Extension   string
+	Lossless    bool // Encode losslessly, for encoders supporting it such as WebP
+	Quality     int  // (default: 0) Quality (1-100) of JPEG and lossy WebP, 0 for the encoder default
+	Progressive bool // Encode JPEG progressively
+	Compression int  // (default: option.CompressionDefault) Compression level of PNG
+	Colors      int  // (default: 0) Palette size (1-256) of GIF, 0 for 256
+	NoDither    bool // Map GIF colors to the palette without dithering
+}
+
+// Name implements the upload.Step interface
+func (Encode) Name() string {
+	return "encode"
+}
+
+// Apply implements the upload.Step interface
+func (s Encode) Apply(ctx context.Context, frame *upload.Frame) error {
+	frame.Output.Reset()
+
+	if encode, ok := s.encoder(); ok {
+		return encode(&frame.Output, frame.Image, s)
+	}
+
+	format, err := imaging.FormatFromExtension(s.Extension)
+	if err != nil {
+		return err
+	}
+
+	if format == imaging.JPEG && s.Progressive {
+		return jpeg.EncodeProgressive(&frame.Output, frame.Image, s.Quality)
+	}
+
+	return imaging.Encode(&frame.Output, frame.Image, format, s.options()...)
+}
+
+// Check returns an error if images cannot be encoded as the type of Extension
+func (s Encode) Check() error {
+	if _, ok := s.encoder(); ok {
+		return nil
+	}
+
+	_, err := imaging.FormatFromExtension(s.Extension)
+	return err
+}
+
+// encoder returns the encoder registered for Extension
+func (s Encode) encoder() (Encoder, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	encode, ok := encoders[normalizeExt(s.Extension)]
+	return encode, ok
+}
+
+// normalizeExt returns extension in lower case without leading dot
+func normalizeExt(extension string) string {
+	return strings.ToLower(strings.TrimPrefix(extension, "."))
+}
+
+// options returns the imaging encoder options of the settings that are not defaults
+func (s Encode) options() []imaging.EncodeOption {
+	var opts []imaging.EncodeOption
+	if s.Quality > 0 {
+		opts = append(opts, imaging.JPEGQuality(s.Quality))
+	}
+	if s.Compression != option.CompressionDefault {
+		opts = append(opts, imaging.PNGCompressionLevel(pngCompression(s.Compression)))
+	}
+	if s.Colors > 0 {
+		opts = append(opts, imaging.GIFNumColors(s.Colors))
+	}
+	if s.NoDither {
+		opts = append(opts, imaging.GIFDrawer(draw.Src))
+	}
+	return opts
+}
+
+// pngCompression returns the png level of a compression option
+func pngCompression(compression int) png.CompressionLevel {
+	switch compression {
+	case option.CompressionNone:
+		return png.NoCompression
+	case option.CompressionBestSpeed:
+		return png.BestSpeed
+	case option.CompressionBest:
+		return png.BestCompression
+	default:
+		return png.DefaultCompression
+	}
+}
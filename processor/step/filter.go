@@ -0,0 +1,22 @@
+package step
+
+import (
+	"context"
+	"image"
+
+	"go.lsl.digital/lardwaz/upload"
+)
+
+// Filter is an adapter to use an image transformation (e.g a colour filter) as a step
+type Filter func(img image.Image) image.Image
+
+// Name implements the upload.Step interface
+func (Filter) Name() string {
+	return "filter"
+}
+
+// Apply implements the upload.Step interface
+func (f Filter) Apply(ctx context.Context, frame *upload.Frame) error {
+	frame.Image = f(frame.Image)
+	return nil
+}
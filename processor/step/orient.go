@@ -0,0 +1,41 @@
+package step
+
+import (
+	"context"
+
+	"github.com/disintegration/imaging"
+	"go.lsl.digital/lardwaz/upload"
+)
+
+// AutoOrient rotates and flips the image according to its EXIF orientation
+type AutoOrient struct{}
+
+// Name implements the upload.Step interface
+func (AutoOrient) Name() string {
+	return "auto_orient"
+}
+
+// Apply implements the upload.Step interface
+func (AutoOrient) Apply(ctx context.Context, frame *upload.Frame) error {
+	switch frame.Orientation {
+	case 2:
+		frame.Image = imaging.FlipH(frame.Image)
+	case 3:
+		frame.Image = imaging.Rotate180(frame.Image)
+	case 4:
+		frame.Image = imaging.FlipV(frame.Image)
+	case 5:
+		frame.Image = imaging.Transpose(frame.Image)
+	case 6:
+		frame.Image = imaging.Rotate270(frame.Image)
+	case 7:
+		frame.Image = imaging.Transverse(frame.Image)
+	case 8:
+		frame.Image = imaging.Rotate90(frame.Image)
+	default:
+		return nil
+	}
+
+	frame.Orientation = 1
+	return nil
+}
@@ -0,0 +1,51 @@
+package step
+
+import (
+	"context"
+
+	"github.com/disintegration/imaging"
+	"go.lsl.digital/lardwaz/upload"
+)
+
+// Resize resizes the image without upscaling it, preserving the aspect ratio when Width or Height is 0
+type Resize struct {
+	Width      int
+	Height     int
+	Resampling int // (default: option.ResampleLanczos)
+}
+
+// Name implements the upload.Step interface
+func (Resize) Name() string {
+	return "resize"
+}
+
+// Apply implements the upload.Step interface
+func (s Resize) Apply(ctx context.Context, frame *upload.Frame) error {
+	bounds := frame.Image.Bounds()
+	width, height := fit(s.Width, s.Height, bounds.Dx(), bounds.Dy())
+
+	frame.Image = imaging.Resize(frame.Image, width, height, resampleFilter(s.Resampling))
+	return nil
+}
+
+// Crop resizes and crops the image around Anchor to fill Width x Height, without upscaling it
+type Crop struct {
+	Width      int
+	Height     int
+	Anchor     imaging.Anchor // (default: imaging.Center)
+	Resampling int            // (default: option.ResampleLanczos)
+}
+
+// Name implements the upload.Step interface
+func (Crop) Name() string {
+	return "crop"
+}
+
+// Apply implements the upload.Step interface
+func (s Crop) Apply(ctx context.Context, frame *upload.Frame) error {
+	bounds := frame.Image.Bounds()
+	width, height := fit(s.Width, s.Height, bounds.Dx(), bounds.Dy())
+
+	frame.Image = imaging.Fill(frame.Image, width, height, s.Anchor, resampleFilter(s.Resampling))
+	return nil
+}
@@ -0,0 +1,52 @@
+// Package step provides the steps of the pipeline generating image formats
+package step
+
+import (
+	"io"
+	"os"
+
+	"github.com/disintegration/imaging"
+	"go.lsl.digital/lardwaz/upload/option"
+	"go.lsl.digital/lardwaz/upload/processor/box"
+)
+
+// openAsset opens a static asset from disk or, in PROD, from the asset box
+func openAsset(path string, isPROD bool) (io.ReadCloser, error) {
+	if isPROD {
+		return box.Asset.Open(path)
+	}
+	return os.Open(path)
+}
+
+// resampleFilter returns the imaging filter of resampling, Lanczos if unknown
+func resampleFilter(resampling int) imaging.ResampleFilter {
+	switch resampling {
+	case option.ResampleCatmullRom:
+		return imaging.CatmullRom
+	case option.ResampleLinear:
+		return imaging.Linear
+	case option.ResampleBox:
+		return imaging.Box
+	case option.ResampleNearestNeighbor:
+		return imaging.NearestNeighbor
+	default:
+		return imaging.Lanczos
+	}
+}
+
+// fit returns width and height bounded by the image dimensions, negative ones being 0
+func fit(width, height, maxWidth, maxHeight int) (int, int) {
+	if width > maxWidth {
+		width = maxWidth
+	}
+	if height > maxHeight {
+		height = maxHeight
+	}
+	if width < 0 {
+		width = 0
+	}
+	if height < 0 {
+		height = 0
+	}
+	return width, height
+}
@@ -0,0 +1,204 @@
+package step_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/option"
+	"go.lsl.digital/lardwaz/upload/processor/step"
+)
+
+func TestResize(t *testing.T) {
+	tests := []struct {
+		name       string
+		step       upload.Step
+		wantWidth  int
+		wantHeight int
+	}{
+		{"resize", step.Resize{Width: 50, Height: 50}, 50, 50},
+		{"resize_aspect", step.Resize{Width: 100}, 100, 50},
+		{"resize_no_upscale", step.Resize{Width: 400, Height: 50}, 200, 50},
+		{"resize_negative", step.Resize{Width: -1, Height: 25}, 50, 25},
+		{"crop", step.Crop{Width: 50, Height: 50}, 50, 50},
+		{"crop_no_upscale", step.Crop{Width: 400, Height: 50}, 200, 50},
+		{"backdrop", step.Backdrop{Path: "missing.png", Width: 300, Height: 300}, 300, 300},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := &upload.Frame{Image: imaging.New(200, 100, color.White)}
+			if err := tt.step.Apply(context.Background(), frame); err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+
+			if got := frame.Image.Bounds(); got.Dx() != tt.wantWidth || got.Dy() != tt.wantHeight {
+				t.Errorf("Apply() size = %dx%d, want %dx%d", got.Dx(), got.Dy(), tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestAutoOrient(t *testing.T) {
+	// A 2x1 image, red on the left
+	red := color.NRGBA{255, 0, 0, 255}
+	src := imaging.New(2, 1, color.NRGBA{0, 0, 255, 255})
+	src.Set(0, 0, red)
+
+	tests := []struct {
+		orientation int
+		wantBounds  image.Rectangle
+		wantRed     image.Point
+	}{
+		{0, image.Rect(0, 0, 2, 1), image.Pt(0, 0)},
+		{1, image.Rect(0, 0, 2, 1), image.Pt(0, 0)},
+		{2, image.Rect(0, 0, 2, 1), image.Pt(1, 0)},
+		{3, image.Rect(0, 0, 2, 1), image.Pt(1, 0)},
+		{4, image.Rect(0, 0, 2, 1), image.Pt(0, 0)},
+		{5, image.Rect(0, 0, 1, 2), image.Pt(0, 0)},
+		{6, image.Rect(0, 0, 1, 2), image.Pt(0, 0)},
+		{7, image.Rect(0, 0, 1, 2), image.Pt(0, 1)},
+		{8, image.Rect(0, 0, 1, 2), image.Pt(0, 1)},
+	}
+	for _, tt := range tests {
+		frame := &upload.Frame{Image: src, Orientation: tt.orientation}
+		if err := (step.AutoOrient{}).Apply(context.Background(), frame); err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+
+		if got := frame.Image.Bounds(); got != tt.wantBounds {
+			t.Errorf("orientation %d: bounds = %v, want %v", tt.orientation, got, tt.wantBounds)
+		}
+		if got := color.NRGBAModel.Convert(frame.Image.At(tt.wantRed.X, tt.wantRed.Y)); got != red {
+			t.Errorf("orientation %d: color at %v = %v, want %v", tt.orientation, tt.wantRed, got, red)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	frame := &upload.Frame{Image: imaging.New(10, 10, color.NRGBA{255, 0, 0, 255})}
+	if err := step.Filter(func(img image.Image) image.Image { return imaging.Invert(img) }).Apply(context.Background(), frame); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	if got, want := color.NRGBAModel.Convert(frame.Image.At(0, 0)), (color.NRGBA{0, 255, 255, 255}); got != want {
+		t.Errorf("color = %v, want %v", got, want)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	// Gradient kept as is by lossless encoders
+	src := image.NewNRGBA(image.Rect(0, 0, 10, 20))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i)
+		if i%4 == 3 {
+			src.Pix[i] = 255
+		}
+	}
+
+	tests := []struct {
+		encode     step.Encode
+		wantFormat string
+		wantExact  bool
+		wantErr    bool
+	}{
+		{step.Encode{Extension: ".png"}, "png", true, false},
+		{step.Encode{Extension: "jpg"}, "jpeg", false, false},
+		{step.Encode{Extension: "GIF"}, "gif", false, false},
+		{step.Encode{Extension: "jpeg", Quality: 50}, "jpeg", false, false},
+		{step.Encode{Extension: ".jpg", Progressive: true}, "jpeg", false, false},
+		{step.Encode{Extension: "PNG", Compression: option.CompressionNone}, "png", true, false},
+		{step.Encode{Extension: ".gif", Colors: 4, NoDither: true}, "gif", false, false},
+		{step.Encode{Extension: "pdf"}, "", false, true},
+		{step.Encode{Extension: "webp"}, "", false, true}, // Unless converter/webp is imported
+	}
+	for _, tt := range tests {
+		t.Run(tt.encode.Extension, func(t *testing.T) {
+			if err := tt.encode.Check(); (err != nil) != tt.wantErr {
+				t.Fatalf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			frame := &upload.Frame{Image: src}
+			err := tt.encode.Apply(context.Background(), frame)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			img, format, err := image.Decode(&frame.Output)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if format != tt.wantFormat || img.Bounds() != src.Bounds() {
+				t.Errorf("encoded %s %v, want %s %v", format, img.Bounds(), tt.wantFormat, src.Bounds())
+			}
+
+			if tt.wantExact {
+				if got := imaging.Clone(img); !bytes.Equal(got.Pix, src.Pix) {
+					t.Errorf("encoded pixels differ from source")
+				}
+			}
+		})
+	}
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	var got step.Encode
+	step.RegisterEncoder(".Test", func(w io.Writer, img image.Image, s step.Encode) error {
+		got = s
+		_, err := w.Write([]byte("encoded"))
+		return err
+	})
+
+	encode := step.Encode{Extension: "TEST", Quality: 40, Lossless: true}
+	if err := encode.Check(); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+
+	frame := &upload.Frame{Image: image.NewNRGBA(image.Rect(0, 0, 1, 1))}
+	if err := encode.Apply(context.Background(), frame); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if frame.Output.String() != "encoded" || got != encode {
+		t.Errorf("Apply() output = %q with %+v, want %q with %+v", frame.Output.String(), got, "encoded", encode)
+	}
+}
+
+func TestResampling(t *testing.T) {
+	// Alternating black and white columns
+	src := imaging.New(8, 8, color.White)
+	for x := 0; x < 8; x += 2 {
+		for y := 0; y < 8; y++ {
+			src.Set(x, y, color.Black)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		resampling int
+		wantBlend  bool
+	}{
+		{"lanczos", option.ResampleLanczos, true},
+		{"box", option.ResampleBox, true},
+		{"nearest_neighbor", option.ResampleNearestNeighbor, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := &upload.Frame{Image: src}
+			if err := (step.Resize{Width: 4, Resampling: tt.resampling}).Apply(context.Background(), frame); err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+
+			r, _, _, _ := frame.Image.At(1, 1).RGBA()
+			if blend := r != 0 && r != 0xffff; blend != tt.wantBlend {
+				t.Errorf("blended pixel = %v, want %v (red %d)", blend, tt.wantBlend, r>>8)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package step
+
+import (
+	"context"
+	"log"
+
+	"github.com/disintegration/imaging"
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/processor/position"
+)
+
+// Watermark overlays the image at Path, anchored by Horizontal and Vertical positions moved by OffsetX and OffsetY.
+// A missing watermark is skipped, unless read from the asset box.
+type Watermark struct {
+	Path       string
+	Horizontal int // (default: position.Left)
+	Vertical   int // (default: position.Top)
+	OffsetX    int
+	OffsetY    int
+	PROD       bool // Read Path from the asset box
+}
+
+// Name implements the upload.Step interface
+func (Watermark) Name() string {
+	return "watermark"
+}
+
+// Apply implements the upload.Step interface
+func (s Watermark) Apply(ctx context.Context, frame *upload.Frame) error {
+	r, err := openAsset(s.Path, s.PROD)
+	if err != nil {
+		if s.PROD {
+			log.Printf("Watermark not found: %v", err)
+			return err
+		}
+		return nil
+	}
+	defer r.Close()
+
+	watermark, err := imaging.Decode(r)
+	if err != nil {
+		return nil
+	}
+
+	bgBounds := frame.Image.Bounds()
+	bgW := bgBounds.Dx()
+	bgH := bgBounds.Dy()
+
+	watermarkBounds := watermark.Bounds()
+	watermarkW := watermarkBounds.Dx()
+	watermarkH := watermarkBounds.Dy()
+
+	var watermarkPos = bgBounds.Min
+
+	switch s.Horizontal {
+	case position.Right:
+		watermarkPos.X += bgW - watermarkW - s.OffsetX
+	case position.Center:
+		watermarkPos.X += bgW/2 - watermarkW/2 + s.OffsetX
+	default:
+		watermarkPos.X += s.OffsetX
+	}
+
+	switch s.Vertical {
+	case position.Bottom:
+		watermarkPos.Y += bgH - watermarkH - s.OffsetY
+	case position.Center:
+		watermarkPos.Y += bgH/2 - watermarkH/2 + s.OffsetY
+	default:
+		watermarkPos.Y += s.OffsetY
+	}
+
+	frame.Image = imaging.Overlay(frame.Image, watermark, watermarkPos, 1.0)
+	return nil
+}
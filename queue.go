@@ -0,0 +1,30 @@
+package upload
+
+import "time"
+
+// Queue represents a persistent queue of pending processing jobs
+type Queue interface {
+	// Push records a pending job and returns it with its ID set.
+	// A job pushed with the ID of a pending job replaces it.
+	Push(job QueuedJob) (QueuedJob, error)
+
+	// Done removes the job with id from pending jobs
+	Done(id string) error
+
+	// Pending returns the jobs pushed and not done yet, oldest first
+	Pending() ([]QueuedJob, error)
+}
+
+// QueuedJob represents a processing job recorded in a Queue
+type QueuedJob struct {
+	ID        string    `json:"id"`
+	Processor string    `json:"processor"`
+	DiskPath  string    `json:"disk_path"`
+	URLPath   string    `json:"url_path"`
+	Validate  bool      `json:"validate"`
+	CreatedAt time.Time `json:"created_at"`
+	// Failures is the number of times processing the job failed
+	Failures int `json:"failures,omitempty"`
+	// Err is the error of the last failure
+	Err string `json:"error,omitempty"`
+}
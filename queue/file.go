@@ -0,0 +1,217 @@
+package queue
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.lsl.digital/lardwaz/upload"
+)
+
+var _ upload.Queue = (*File)(nil)
+
+// Operations recorded in the log of File
+const (
+	opPush = "push"
+	opDone = "done"
+)
+
+// record is a line of the log of File
+type record struct {
+	Op  string            `json:"op"`
+	Job *upload.QueuedJob `json:"job,omitempty"`
+	ID  string            `json:"id,omitempty"`
+}
+
+// File implements upload.Queue on an append-only JSON lines log on the local disk.
+// Every operation is synced to disk before returning so that pending jobs survive a crash.
+type File struct {
+	mu      sync.Mutex
+	path    string
+	log     *os.File
+	pending []upload.QueuedJob
+}
+
+// NewFile opens or creates the queue logged at path.
+// The log is compacted to the jobs still pending.
+func NewFile(path string) (*File, error) {
+	pending, err := readLog(path)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &File{path: path, pending: pending}
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// Push records a pending job and returns it with its ID set.
+// A job pushed with the ID of a pending job replaces it.
+func (q *File) Push(job upload.QueuedJob) (upload.QueuedJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if job.ID == "" {
+		job.ID = newID()
+	}
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = time.Now()
+	}
+
+	if err := q.append(record{Op: opPush, Job: &job}); err != nil {
+		return job, err
+	}
+	q.pending = append(remove(q.pending, job.ID), job)
+
+	return job, nil
+}
+
+// Done removes the job with id from pending jobs
+func (q *File) Done(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.append(record{Op: opDone, ID: id}); err != nil {
+		return err
+	}
+	q.pending = remove(q.pending, id)
+
+	return nil
+}
+
+// Pending returns the jobs pushed and not done yet, oldest first
+func (q *File) Pending() ([]upload.QueuedJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return append([]upload.QueuedJob(nil), q.pending...), nil
+}
+
+// Close closes the log
+func (q *File) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.log.Close()
+}
+
+// append writes r at the end of the log
+func (q *File) append(r record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	if _, err := q.log.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	return q.log.Sync()
+}
+
+// compact rewrites the log with pending jobs only then opens it for appending
+func (q *File) compact() error {
+	if err := os.MkdirAll(filepath.Dir(q.path), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(q.path), "."+filepath.Base(q.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for i := range q.pending {
+		line, err := json.Marshal(record{Op: opPush, Job: &q.pending[i]})
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		w.Write(append(line, '\n'))
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), q.path); err != nil {
+		return err
+	}
+
+	q.log, err = os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, os.FileMode(0644))
+
+	return err
+}
+
+// readLog returns the jobs pending in the log at path
+func readLog(path string) ([]upload.QueuedJob, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var pending []upload.QueuedJob
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// A crash may leave the last line half written
+			if !scanner.Scan() {
+				break
+			}
+			return nil, fmt.Errorf("queue %s line %d: %v", path, line, err)
+		}
+
+		switch {
+		case r.Op == opPush && r.Job != nil:
+			pending = append(remove(pending, r.Job.ID), *r.Job)
+		case r.Op == opDone:
+			pending = remove(pending, r.ID)
+		}
+	}
+
+	return pending, scanner.Err()
+}
+
+// remove returns jobs without the job with id
+func remove(jobs []upload.QueuedJob, id string) []upload.QueuedJob {
+	for i, job := range jobs {
+		if job.ID == id {
+			return append(jobs[:i:i], jobs[i+1:]...)
+		}
+	}
+
+	return jobs
+}
+
+// newID returns a random job ID
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,164 @@
+package queue_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/queue"
+)
+
+func tempLog(t *testing.T) (string, func()) {
+	t.Helper()
+
+	root, err := ioutil.TempDir("", "upload")
+	if err != nil {
+		t.Fatalf("TempDir() error = %v", err)
+	}
+
+	return filepath.Join(root, "queue", "jobs.log"), func() { os.RemoveAll(root) }
+}
+
+func pendingPaths(t *testing.T, q upload.Queue) []string {
+	t.Helper()
+
+	pending, err := q.Pending()
+	if err != nil {
+		t.Fatalf("Pending() error = %v", err)
+	}
+
+	var paths []string
+	for _, job := range pending {
+		paths = append(paths, job.DiskPath)
+	}
+
+	return paths
+}
+
+func TestFile(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	q, err := queue.NewFile(path)
+	if err != nil {
+		t.Fatalf("NewFile() error = %v", err)
+	}
+
+	var ids []string
+	for _, diskPath := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		job, err := q.Push(upload.QueuedJob{Processor: "thumbs", DiskPath: diskPath})
+		if err != nil {
+			t.Fatalf("Push() error = %v", err)
+		}
+		if job.ID == "" || job.CreatedAt.IsZero() {
+			t.Errorf("Push() = %+v, want ID and CreatedAt set", job)
+		}
+		ids = append(ids, job.ID)
+	}
+
+	if err := q.Done(ids[1]); err != nil {
+		t.Fatalf("Done() error = %v", err)
+	}
+
+	if got, want := pendingPaths(t, q), []string{"a.jpg", "c.jpg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Pending() = %v, want %v", got, want)
+	}
+
+	// Pending jobs survive reopening, as after a crash
+	if err := q.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	q, err = queue.NewFile(path)
+	if err != nil {
+		t.Fatalf("NewFile() error = %v", err)
+	}
+	defer q.Close()
+
+	if got, want := pendingPaths(t, q), []string{"a.jpg", "c.jpg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Pending() after reopen = %v, want %v", got, want)
+	}
+
+	// The log is compacted on open
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(content, []byte("\n")); lines != 2 {
+		t.Errorf("log lines = %d, want %d", lines, 2)
+	}
+}
+
+func TestFilePushReplaces(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	q, err := queue.NewFile(path)
+	if err != nil {
+		t.Fatalf("NewFile() error = %v", err)
+	}
+
+	job, err := q.Push(upload.QueuedJob{DiskPath: "a.jpg"})
+	if err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+
+	job.Failures, job.Err = 1, "storage unavailable"
+	if _, err := q.Push(job); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+
+	for _, reopen := range []bool{false, true} {
+		if reopen {
+			q.Close()
+			if q, err = queue.NewFile(path); err != nil {
+				t.Fatalf("NewFile() error = %v", err)
+			}
+		}
+
+		pending, err := q.Pending()
+		if err != nil {
+			t.Fatalf("Pending() error = %v", err)
+		}
+		if len(pending) != 1 || pending[0].Failures != 1 || pending[0].Err != job.Err {
+			t.Errorf("Pending() (reopened: %v) = %+v, want the job replaced", reopen, pending)
+		}
+	}
+	q.Close()
+}
+
+func TestFileTruncated(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	q, err := queue.NewFile(path)
+	if err != nil {
+		t.Fatalf("NewFile() error = %v", err)
+	}
+	if _, err := q.Push(upload.QueuedJob{DiskPath: "a.jpg"}); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	q.Close()
+
+	// A crash in the middle of a write
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"push","job":{"id":"b","disk`)
+	f.Close()
+
+	q, err = queue.NewFile(path)
+	if err != nil {
+		t.Fatalf("NewFile() error = %v", err)
+	}
+	defer q.Close()
+
+	if got, want := pendingPaths(t, q), []string{"a.jpg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Pending() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,52 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"image"
+)
+
+// Step represents a stage of the pipeline generating a format (e.g resize, watermark)
+type Step interface {
+	Name() string
+
+	// Apply transforms frame, stopping early once ctx is done
+	Apply(ctx context.Context, frame *Frame) error
+}
+
+// Frame holds a format being generated by a pipeline of steps
+type Frame struct {
+	File   Uploaded
+	Format OptionsFormat
+
+	// Image is the decoded image, transformed by each step.
+	// It may be shared with other formats: steps replace it and never modify it in place.
+	Image image.Image
+
+	// Orientation is the EXIF orientation of Image, 0 if unknown
+	Orientation int
+
+	// Output is the encoded image written to storage
+	Output bytes.Buffer
+}
+
+// Placed is a custom step of a format run next to the step named Anchor of its pipeline
+type Placed struct {
+	Step
+
+	// Anchor is the name of the step Step is placed next to (e.g resize, watermark, encode)
+	Anchor string
+
+	// After places Step after Anchor rather than before it
+	After bool
+}
+
+// Before places s before the step named anchor
+func Before(anchor string, s Step) Placed {
+	return Placed{Step: s, Anchor: anchor}
+}
+
+// After places s after the step named anchor
+func After(anchor string, s Step) Placed {
+	return Placed{Step: s, Anchor: anchor, After: true}
+}
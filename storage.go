@@ -0,0 +1,36 @@
+package upload
+
+import (
+	"io"
+	"os"
+)
+
+// Storage represents a storage backend for uploaded files
+type Storage interface {
+	// Put writes the content of r at path, replacing any existing file
+	Put(path string, r io.Reader) error
+
+	// Create writes the content of r at path, failing with ErrFileExists if a file exists at path
+	Create(path string, r io.Reader) error
+
+	// Get opens the file at path for reading
+	Get(path string) (io.ReadCloser, error)
+
+	// Stat returns information about the file at path
+	Stat(path string) (os.FileInfo, error)
+
+	// Rename moves the file at oldPath to newPath
+	Rename(oldPath, newPath string) error
+
+	// Delete removes the file at path
+	Delete(path string) error
+
+	// List returns the path of every file starting with prefix
+	List(prefix string) ([]string, error)
+}
+
+// StorageURLer represents a storage serving its files under its own URLs
+type StorageURLer interface {
+	// URL returns the public url of the file at path
+	URL(path string) string
+}
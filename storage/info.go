@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"os"
+	"path"
+	"time"
+)
+
+// fileInfo implements os.FileInfo for files without an actual disk entry
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func newFileInfo(name string, size int64, modTime time.Time) *fileInfo {
+	return &fileInfo{
+		name:    path.Base(name),
+		size:    size,
+		modTime: modTime,
+	}
+}
+
+// Name returns the base name of the file
+func (i *fileInfo) Name() string {
+	return i.name
+}
+
+// Size returns the length in bytes of the file
+func (i *fileInfo) Size() int64 {
+	return i.size
+}
+
+// Mode returns the file mode bits
+func (i *fileInfo) Mode() os.FileMode {
+	return os.FileMode(0644)
+}
+
+// ModTime returns the modification time
+func (i *fileInfo) ModTime() time.Time {
+	return i.modTime
+}
+
+// IsDir always returns false
+func (i *fileInfo) IsDir() bool {
+	return false
+}
+
+// Sys always returns nil
+func (i *fileInfo) Sys() interface{} {
+	return nil
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.lsl.digital/lardwaz/upload"
+)
+
+var (
+	_ upload.Storage = (*Local)(nil)
+	_ upload.Storage = (*Memory)(nil)
+	_ upload.Storage = (*S3)(nil)
+)
+
+// Local implements upload.Storage on the local disk
+type Local struct{}
+
+// NewLocal returns a new Local
+func NewLocal() *Local {
+	return &Local{}
+}
+
+// Put writes the content of r at path, creating missing directories
+func (s *Local) Put(path string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(0644))
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Create writes the content of r at path unless it exists (O_EXCL semantics).
+// Content is written next to path first so that no partial file is ever visible.
+func (s *Local) Create(path string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), os.FileMode(0644)); err != nil {
+		return err
+	}
+
+	// Linking fails atomically if path exists
+	if err := os.Link(tmp.Name(), path); err != nil {
+		if os.IsExist(err) {
+			return upload.ErrFileExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Get opens the file at path for reading
+func (s *Local) Get(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+// Stat returns information about the file at path
+func (s *Local) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+// Rename moves the file at oldPath to newPath, creating missing directories
+func (s *Local) Rename(oldPath, newPath string) error {
+	if err := os.MkdirAll(filepath.Dir(newPath), os.ModePerm); err != nil {
+		return err
+	}
+
+	return os.Rename(oldPath, newPath)
+}
+
+// Delete removes the file at path
+func (s *Local) Delete(path string) error {
+	return os.Remove(path)
+}
+
+// List returns the path of every file starting with prefix
+func (s *Local) List(prefix string) ([]string, error) {
+	root := prefix
+	if info, err := os.Stat(prefix); err != nil || !info.IsDir() {
+		root = filepath.Dir(prefix)
+	}
+
+	var paths []string
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if !info.IsDir() && strings.HasPrefix(path, filepath.Clean(prefix)) {
+			paths = append(paths, path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(paths)
+
+	return paths, nil
+}
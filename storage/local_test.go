@@ -0,0 +1,19 @@
+package storage_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"go.lsl.digital/lardwaz/upload/storage"
+)
+
+func TestLocal(t *testing.T) {
+	root, err := ioutil.TempDir("", "upload")
+	if err != nil {
+		t.Fatalf("TempDir() error = %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	testStorage(t, storage.NewLocal(), root)
+}
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.lsl.digital/lardwaz/upload"
+)
+
+// Memory implements upload.Storage in memory (useful for tests and ephemeral environments)
+type Memory struct {
+	mu     sync.RWMutex
+	files  map[string]*memoryFile
+	writes int
+}
+
+type memoryFile struct {
+	content []byte
+	modTime time.Time
+}
+
+// NewMemory returns a new Memory
+func NewMemory() *Memory {
+	return &Memory{
+		files: make(map[string]*memoryFile),
+	}
+}
+
+// Put stores the content of r at path
+func (s *Memory) Put(p string, r io.Reader) error {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.files[path.Clean(p)] = &memoryFile{content: content, modTime: time.Now()}
+	s.writes++
+
+	return nil
+}
+
+// Create stores the content of r at path unless it exists
+func (s *Memory) Create(p string, r io.Reader) error {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.files[path.Clean(p)]; ok {
+		return upload.ErrFileExists
+	}
+
+	s.files[path.Clean(p)] = &memoryFile{content: content, modTime: time.Now()}
+	s.writes++
+
+	return nil
+}
+
+// Get opens the file at path for reading
+func (s *Memory) Get(p string) (io.ReadCloser, error) {
+	f, err := s.file("get", p)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(f.content)), nil
+}
+
+// Stat returns information about the file at path
+func (s *Memory) Stat(p string) (os.FileInfo, error) {
+	f, err := s.file("stat", p)
+	if err != nil {
+		return nil, err
+	}
+
+	return newFileInfo(p, int64(len(f.content)), f.modTime), nil
+}
+
+// Rename moves the file at oldPath to newPath
+func (s *Memory) Rename(oldPath, newPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.files[path.Clean(oldPath)]
+	if !ok {
+		return &os.PathError{Op: "rename", Path: oldPath, Err: os.ErrNotExist}
+	}
+
+	delete(s.files, path.Clean(oldPath))
+	s.files[path.Clean(newPath)] = f
+
+	return nil
+}
+
+// Delete removes the file at path
+func (s *Memory) Delete(p string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.files[path.Clean(p)]; !ok {
+		return &os.PathError{Op: "delete", Path: p, Err: os.ErrNotExist}
+	}
+
+	delete(s.files, path.Clean(p))
+
+	return nil
+}
+
+// List returns the path of every file starting with prefix
+func (s *Memory) List(prefix string) ([]string, error) {
+	prefix = path.Clean(prefix)
+
+	var paths []string
+	for _, p := range s.Keys() {
+		if strings.HasPrefix(p, prefix) {
+			paths = append(paths, p)
+		}
+	}
+
+	return paths, nil
+}
+
+// Keys returns the sorted path of every stored file
+func (s *Memory) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]string, 0, len(s.files))
+	for p := range s.files {
+		keys = append(keys, p)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Bytes returns the content of the file at path, if present
+func (s *Memory) Bytes(p string) ([]byte, bool) {
+	f, err := s.file("get", p)
+	if err != nil {
+		return nil, false
+	}
+
+	return append([]byte(nil), f.content...), true
+}
+
+// Writes returns the number of successful Put and Create calls so far
+func (s *Memory) Writes() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.writes
+}
+
+// file returns the file stored at path or a not exist error for op
+func (s *Memory) file(op, p string) (*memoryFile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f, ok := s.files[path.Clean(p)]
+	if !ok {
+		return nil, &os.PathError{Op: op, Path: p, Err: os.ErrNotExist}
+	}
+
+	return f, nil
+}
@@ -0,0 +1,39 @@
+package storage_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"go.lsl.digital/lardwaz/upload/storage"
+)
+
+func TestMemory(t *testing.T) {
+	testStorage(t, storage.NewMemory(), "root")
+}
+
+func TestMemoryInspection(t *testing.T) {
+	s := storage.NewMemory()
+
+	for _, p := range []string{"b/file", "a/file", "a//file"} {
+		if err := s.Put(p, bytes.NewReader([]byte(p))); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	if got, want := s.Keys(), []string{"a/file", "b/file"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() = %v, want %v", got, want)
+	}
+
+	if got, ok := s.Bytes("a/file"); !ok || string(got) != "a//file" {
+		t.Errorf("Bytes() = %s, %v, want %s, true", got, ok, "a//file")
+	}
+
+	if _, ok := s.Bytes("c/file"); ok {
+		t.Errorf("Bytes() of missing file should not be ok")
+	}
+
+	if got := s.Writes(); got != 3 {
+		t.Errorf("Writes() = %d, want %d", got, 3)
+	}
+}
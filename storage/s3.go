@@ -0,0 +1,429 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"go.lsl.digital/lardwaz/upload"
+)
+
+const (
+	s3Algorithm   = "AWS4-HMAC-SHA256"
+	s3Service     = "s3"
+	s3DateFormat  = "20060102T150405Z"
+	s3ShortFormat = "20060102"
+)
+
+// S3 implements upload.Storage on an S3 compatible object storage (path-style addressing)
+type S3 struct {
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	publicURL string
+	client    *http.Client
+	now       func() time.Time
+}
+
+// NewS3 returns a new S3 storing files in bucket at endpoint (e.g https://s3.eu-west-1.amazonaws.com)
+func NewS3(endpoint, region, bucket, accessKey, secretKey string) *S3 {
+	endpoint = strings.TrimSuffix(endpoint, "/")
+
+	return &S3{
+		endpoint:  endpoint,
+		region:    region,
+		bucket:    bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		publicURL: endpoint + "/" + bucket,
+		client:    http.DefaultClient,
+		now:       time.Now,
+	}
+}
+
+// SetPublicURL sets the base url files are served from (default: endpoint/bucket)
+func (s *S3) SetPublicURL(u string) *S3 {
+	s.publicURL = strings.TrimSuffix(u, "/")
+
+	return s
+}
+
+// SetClient sets the http client used to reach the endpoint
+func (s *S3) SetClient(c *http.Client) *S3 {
+	s.client = c
+
+	return s
+}
+
+// URL returns the public url of the object at path
+func (s *S3) URL(path string) string {
+	return s.publicURL + "/" + s.key(path)
+}
+
+// Put uploads the content of r as the object at path (PutObject)
+func (s *S3) Put(path string, r io.Reader) error {
+	return s.put(path, r, false)
+}
+
+// Create uploads the content of r as the object at path unless it exists (conditional PutObject)
+func (s *S3) Create(path string, r io.Reader) error {
+	return s.put(path, r, true)
+}
+
+// put uploads the content of r as the object at path, only if none exists when exclusive
+func (s *S3) put(path string, r io.Reader, exclusive bool) error {
+	// Spool content to know its length and hash without holding it in memory
+	tmp, err := ioutil.TempFile("", "upload-s3-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	req, err := s.request(http.MethodPut, s.key(path), nil, ioutil.NopCloser(tmp))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if exclusive {
+		req.Header.Set("If-None-Match", "*")
+	}
+
+	res, err := s.do(req, hex.EncodeToString(hash.Sum(nil)), path)
+	if err != nil {
+		return err
+	}
+
+	return res.Body.Close()
+}
+
+// Get opens the object at path for reading (GetObject)
+func (s *S3) Get(path string) (io.ReadCloser, error) {
+	req, err := s.request(http.MethodGet, s.key(path), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.do(req, emptyPayloadHash, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+// Stat returns information about the object at path (HeadObject)
+func (s *S3) Stat(path string) (os.FileInfo, error) {
+	req, err := s.request(http.MethodHead, s.key(path), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.do(req, emptyPayloadHash, path)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+
+	modTime, _ := http.ParseTime(res.Header.Get("Last-Modified"))
+
+	return newFileInfo(path, res.ContentLength, modTime), nil
+}
+
+// Rename copies the object at oldPath to newPath then deletes the old one (CopyObject + DeleteObject)
+func (s *S3) Rename(oldPath, newPath string) error {
+	req, err := s.request(http.MethodPut, s.key(newPath), nil, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Amz-Copy-Source", "/"+s.bucket+"/"+uriEncode(s.key(oldPath), false))
+
+	res, err := s.do(req, emptyPayloadHash, oldPath)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	return s.Delete(oldPath)
+}
+
+// Delete removes the object at path (DeleteObject)
+func (s *S3) Delete(path string) error {
+	req, err := s.request(http.MethodDelete, s.key(path), nil, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.do(req, emptyPayloadHash, path)
+	if err != nil {
+		return err
+	}
+
+	return res.Body.Close()
+}
+
+// List returns the path of every object starting with prefix (ListObjectsV2)
+func (s *S3) List(prefix string) ([]string, error) {
+	var (
+		paths []string
+		token string
+	)
+
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", s.key(prefix))
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		req, err := s.request(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := s.do(req, emptyPayloadHash, prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		var result s3ListResult
+		err = xml.NewDecoder(res.Body).Decode(&result)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			paths = append(paths, object.Key)
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// key returns the object key of path
+func (s *S3) key(p string) string {
+	if p == "" {
+		return ""
+	}
+
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
+
+// request returns a new request for the object key in bucket
+func (s *S3) request(method, key string, query url.Values, body io.ReadCloser) (*http.Request, error) {
+	u, err := url.Parse(s.endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Path = "/" + s.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = "/" + s.bucket
+	if key != "" {
+		u.RawPath += "/" + uriEncode(key, false)
+	}
+	if query != nil {
+		u.RawQuery = canonicalQuery(query)
+	}
+
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Body = body
+	}
+
+	return req, nil
+}
+
+// do signs and sends req, turning error responses into errors
+func (s *S3) do(req *http.Request, payloadHash, path string) (*http.Response, error) {
+	s.sign(req, payloadHash)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, &os.PathError{Op: strings.ToLower(req.Method), Path: path, Err: os.ErrNotExist}
+	}
+
+	if res.StatusCode == http.StatusPreconditionFailed && req.Header.Get("If-None-Match") == "*" {
+		return nil, upload.ErrFileExists
+	}
+
+	var s3Err s3Error
+	if err := xml.NewDecoder(res.Body).Decode(&s3Err); err != nil || s3Err.Code == "" {
+		return nil, fmt.Errorf("s3 %s %s: %s", req.Method, path, res.Status)
+	}
+
+	return nil, fmt.Errorf("s3 %s %s: %s: %s", req.Method, path, s3Err.Code, s3Err.Message)
+}
+
+// sign adds AWS Signature Version 4 headers to req
+func (s *S3) sign(req *http.Request, payloadHash string) {
+	now := s.now().UTC()
+	date := now.Format(s3DateFormat)
+	scope := strings.Join([]string{now.Format(s3ShortFormat), s.region, s3Service, "aws4_request"}, "/")
+
+	req.Header.Set("X-Amz-Date", date)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers, signedHeaders := canonicalHeaders(req)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		headers,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		date,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), now.Format(s3ShortFormat))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.accessKey, scope, signedHeaders, signature))
+}
+
+// emptyPayloadHash is the SHA256 of an empty payload
+var emptyPayloadHash = sha256Hex(nil)
+
+// s3ListResult is the ListObjectsV2 response body
+type s3ListResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// s3Error is the error response body
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// canonicalHeaders returns the SigV4 canonical headers and signed headers list of req
+func canonicalHeaders(req *http.Request) (string, string) {
+	values := map[string]string{"host": req.URL.Host}
+	for name, value := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "content-type" || name == "content-md5" || name == "range" {
+			values[name] = strings.TrimSpace(strings.Join(value, ","))
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var headers strings.Builder
+	for _, name := range names {
+		headers.WriteString(name + ":" + values[name] + "\n")
+	}
+
+	return headers.String(), strings.Join(names, ";")
+}
+
+// canonicalQuery returns the SigV4 canonical query string of query
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			pairs = append(pairs, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode encodes s as specified by SigV4, keeping slashes unless encodeSlash
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '.', c == '_', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
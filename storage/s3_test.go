@@ -0,0 +1,143 @@
+package storage_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.lsl.digital/lardwaz/upload/storage"
+)
+
+// fakeS3 implements the subset of the S3 REST API used by storage.S3
+type fakeS3 struct {
+	bucket  string
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/"+f.bucket), "/")
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		f.list(w, r)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		source, _ := url.PathUnescape(strings.TrimPrefix(r.Header.Get("X-Amz-Copy-Source"), "/"+f.bucket+"/"))
+		content, ok := f.objects[source]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		f.objects[key] = content
+		w.Write([]byte("<CopyObjectResult></CopyObjectResult>"))
+	case r.Method == http.MethodPut:
+		if _, ok := f.objects[key]; ok && r.Header.Get("If-None-Match") == "*" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		content, _ := ioutil.ReadAll(r.Body)
+		sum := sha256.Sum256(content)
+		if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("<Error><Code>XAmzContentSHA256Mismatch</Code><Message>hash mismatch</Message></Error>"))
+			return
+		}
+		f.objects[key] = content
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		content, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			w.Write(content)
+		}
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// list answers ListObjectsV2 one key at a time to exercise continuation
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, r.URL.Query().Get("prefix")) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	start := 0
+	if token := r.URL.Query().Get("continuation-token"); token != "" {
+		start, _ = strconv.Atoi(token)
+	}
+
+	type object struct {
+		Key string `xml:"Key"`
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []object `xml:"Contents"`
+		IsTruncated           bool     `xml:"IsTruncated"`
+		NextContinuationToken string   `xml:"NextContinuationToken,omitempty"`
+	}{}
+
+	if start < len(keys) {
+		result.Contents = []object{{Key: keys[start]}}
+	}
+	if start+1 < len(keys) {
+		result.IsTruncated = true
+		result.NextContinuationToken = strconv.Itoa(start + 1)
+	}
+
+	xml.NewEncoder(w).Encode(result)
+}
+
+func TestS3(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{bucket: "bucket", objects: make(map[string][]byte)})
+	defer server.Close()
+
+	testStorage(t, storage.NewS3(server.URL, "us-east-1", "bucket", "key", "secret"), "root dir")
+}
+
+func TestS3URL(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage *storage.S3
+		path    string
+		want    string
+	}{
+		{"endpoint", storage.NewS3("https://s3.example.com/", "us-east-1", "bucket", "", ""), "media/a.jpg", "https://s3.example.com/bucket/media/a.jpg"},
+		{"public url", storage.NewS3("https://s3.example.com", "us-east-1", "bucket", "", "").SetPublicURL("https://cdn.example.com/"), "/media/./a.jpg", "https://cdn.example.com/media/a.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.storage.URL(tt.path); got != tt.want {
+				t.Errorf("URL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
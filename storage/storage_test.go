@@ -0,0 +1,84 @@
+package storage_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"testing"
+
+	"go.lsl.digital/lardwaz/upload"
+)
+
+// testStorage runs the common upload.Storage checks against s, storing files under root
+func testStorage(t *testing.T, s upload.Storage, root string) {
+	content := []byte("some content")
+	filePath := path.Join(root, "media", "file.txt")
+	otherPath := path.Join(root, "media", "sub", "other.txt")
+	newPath := path.Join(root, "new", "file.txt")
+
+	if err := s.Put(filePath, bytes.NewReader(content)); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	r, err := s.Get(filePath)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	got, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatalf("Get() read error = %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("Get() = %s, want %s", got, content)
+	}
+
+	info, err := s.Stat(filePath)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if info.Size() != int64(len(content)) {
+		t.Errorf("Stat().Size() = %d, want %d", info.Size(), len(content))
+	}
+
+	if err := s.Create(newPath, bytes.NewReader(content)); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := s.Delete(newPath); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if err := s.Rename(filePath, otherPath); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	if _, err := s.Stat(filePath); err == nil {
+		t.Errorf("Stat() of renamed file should fail")
+	}
+
+	if err := s.Put(filePath, bytes.NewReader(content)); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	if err := s.Create(filePath, bytes.NewReader(content)); err != upload.ErrFileExists {
+		t.Errorf("Create() of existing file error = %v, want %v", err, upload.ErrFileExists)
+	}
+
+	paths, err := s.List(path.Join(root, "media"))
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if want := []string{filePath, otherPath}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("List() = %v, want %v", paths, want)
+	}
+
+	for _, p := range []string{filePath, otherPath} {
+		if err := s.Delete(p); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+	}
+
+	if _, err := s.Get(filePath); err == nil {
+		t.Errorf("Get() of deleted file should fail")
+	}
+}
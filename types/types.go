@@ -14,6 +14,9 @@ var (
 	TypePNG   = matchers.TypePng
 	TypeGIF   = matchers.TypeGif
 	TypeHEIF  = matchers.TypeHeif
+	TypeBMP   = matchers.TypeBmp
+	TypeTIFF  = matchers.TypeTiff
+	TypeWEBP  = matchers.TypeWebp
 	TypeMP3   = matchers.TypeMp3
 	TypeAAC   = matchers.TypeAac
 	TypeDOC   = matchers.TypeDoc
@@ -41,6 +44,9 @@ var SupportedTypes = matchers.Map{
 	TypePNG:   matchers.Png,
 	TypeGIF:   matchers.Gif,
 	TypeHEIF:  matchers.Heif,
+	TypeBMP:   matchers.Bmp,
+	TypeTIFF:  matchers.Tiff,
+	TypeWEBP:  matchers.Webp,
 	// Audio
 	TypeMP3: matchers.Mp3,
 	TypeAAC: matchers.Aac,
@@ -81,5 +87,7 @@ func IsValidImage(content []byte) bool {
 	return (matchers.Jpeg(content) ||
 		matchers.Jpeg2000(content) ||
 		matchers.Png(content) ||
-		matchers.Gif(content))
+		matchers.Gif(content) ||
+		matchers.Bmp(content) ||
+		matchers.Tiff(content))
 }
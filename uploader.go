@@ -1,8 +1,22 @@
 package upload // import "go.lsl.digital/lardwaz/upload"
 
+import (
+	"context"
+	"io"
+)
+
 // Uploader represents a file uploader (SMI)
 type Uploader interface {
 	// Upload accepts a filename, content and
 	// returns a file disk path, file url path and error
 	Upload(filename string, content []byte) (Uploaded, error)
 }
+
+// StreamUploader represents a file uploader able to stream content
+type StreamUploader interface {
+	Uploader
+
+	// UploadReader accepts a filename, a reader of content and its size (-1 if unknown)
+	// and returns the uploaded file without holding its whole content in memory
+	UploadReader(ctx context.Context, filename string, r io.Reader, size int64) (Uploaded, error)
+}
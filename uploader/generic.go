@@ -1,7 +1,10 @@
 package uploader
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 
 	"github.com/h2non/filetype"
 	"go.lsl.digital/lardwaz/upload"
@@ -24,11 +27,28 @@ func NewGeneric(opts ...func(upload.Options)) *Generic {
 func (u *Generic) Upload(name string, content []byte) (upload.Uploaded, error) {
 	fileType, err := filetype.Match(content)
 	if err != nil {
-		return nil, fmt.Errorf("Error retrieving file type: %v", err)
+		return nil, fmt.Errorf("%w: error retrieving file type: %v", upload.ErrUnknownType, err)
 	}
 
 	if !u.Options.FileTypeExist(fileType) {
-		return nil, fmt.Errorf("Unknown file type")
+		return nil, upload.ErrUnknownType
+	}
+
+	c, newType, err := converterOf(fileType, u.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	if c != nil {
+		if err := checkSize(name, int64(len(content)), u.Options); err != nil {
+			return nil, err
+		}
+
+		var converted bytes.Buffer
+		if err := c.Convert(&converted, bytes.NewReader(content)); err != nil {
+			return nil, err
+		}
+		name, content = convertedName(name, newType.Extension), converted.Bytes()
 	}
 
 	uploadedFile := file.NewGeneric(name, u.Options)
@@ -37,10 +57,65 @@ func (u *Generic) Upload(name string, content []byte) (upload.Uploaded, error) {
 		return nil, err
 	}
 
-	newType := u.Options.ConvertTo(fileType)
 	if err := uploadedFile.ChangeExt(newType.Extension); err != nil {
+		// Do not leave the file behind under its former name, unless earlier uploads own it
+		if !uploadedFile.Duplicate() {
+			uploadedFile.Storage().Delete(uploadedFile.DiskPath())
+		}
+		return nil, err
+	}
+
+	emit(u.Options, upload.EventUploaded, uploadedFile)
+
+	return uploadedFile, nil
+}
+
+// UploadReader method to satisfy stream uploader interface
+func (u *Generic) UploadReader(ctx context.Context, name string, r io.Reader, size int64) (upload.Uploaded, error) {
+	if err := checkSize(name, size, u.Options); err != nil {
+		return nil, err
+	}
+
+	head, r, err := sniff(&contextReader{ctx: ctx, r: r})
+	if err != nil {
+		return nil, err
+	}
+
+	fileType, err := filetype.Match(head)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error retrieving file type: %v", upload.ErrUnknownType, err)
+	}
+
+	if !u.Options.FileTypeExist(fileType) {
+		return nil, upload.ErrUnknownType
+	}
+
+	c, newType, err := converterOf(fileType, u.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	if c != nil {
+		converted := newConvertReader(c, file.NewMaxSizeReader(r, u.Options.MaxSize()))
+		defer converted.Close()
+		name, r = convertedName(name, newType.Extension), converted
+	}
+
+	uploadedFile := file.NewGeneric(name, u.Options)
+
+	if err := uploadedFile.SaveReader(r, true); err != nil {
+		return nil, err
+	}
+
+	if err := uploadedFile.ChangeExt(newType.Extension); err != nil {
+		// Do not leave the file behind under its former name, unless earlier uploads own it
+		if !uploadedFile.Duplicate() {
+			uploadedFile.Storage().Delete(uploadedFile.DiskPath())
+		}
 		return nil, err
 	}
 
+	emit(u.Options, upload.EventUploaded, uploadedFile)
+
 	return uploadedFile, nil
 }
@@ -2,13 +2,26 @@ package uploader_test
 
 // Basic imports
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/suite"
 	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/event"
 	"go.lsl.digital/lardwaz/upload/option"
+	"go.lsl.digital/lardwaz/upload/storage"
 	utypes "go.lsl.digital/lardwaz/upload/types"
 	"go.lsl.digital/lardwaz/upload/uploader"
 )
@@ -25,11 +38,15 @@ type genericUploadTest struct {
 type GenericUploaderTestSuite struct {
 	suite.Suite
 	genericUploadTests []genericUploadTest
+	storage            *storage.Memory
 }
 
 func (s *GenericUploaderTestSuite) SetupSuite() {
+	s.storage = storage.NewMemory()
+
 	// Common upload configurations
 	common := []func(upload.Options){
+		option.Storage(s.storage),
 		option.Dir(testDataFolder),
 		option.Destination("tmp"),
 		option.MediaPrefixURL("/" + testDataFolder + "/"),
@@ -45,7 +62,7 @@ func (s *GenericUploaderTestSuite) SetupSuite() {
 	// Test cases
 	s.genericUploadTests = []genericUploadTest{
 		{"PDF", "normal.pdf", "normal_out.pdf", false, false, uploader.NewGeneric(common...)},
-		{"PDF to MP3", "normal.pdf", "normal_convert_out.mp3", false, false, uploader.NewGeneric(commonPDFMP3Opts...)},
+		{"PDF to MP3 (no converter)", "normal.pdf", "normal_out.mp3", true, false, uploader.NewGeneric(commonPDFMP3Opts...)},
 		{"PDF", "normal.pdf", "normal_out.pdf", false, false, uploader.NewGeneric(common...)},
 		{"MP3", "normal.mp3", "normal_out.mp3", false, false, uploader.NewGeneric(common...)},
 		{"MP4", "normal.mp4", "normal_out.mp4", false, false, uploader.NewGeneric(common...)},
@@ -83,12 +100,12 @@ func (s *GenericUploaderTestSuite) TestGenericUpload() {
 				}
 			}()
 
-			content, err := ioutil.ReadFile(uploaded.DiskPath())
-			if tt.expectedContentError && err != nil {
+			content, ok := s.storage.Bytes(uploaded.DiskPath())
+			if tt.expectedContentError && !ok {
 				// No problemo; we anticipated!
 				return
-			} else if err != nil {
-				s.Failf("Cannot open uploaded file", "%s: %v", uploaded.DiskPath(), err)
+			} else if !ok {
+				s.Failf("Cannot open uploaded file", "%s", uploaded.DiskPath())
 				return
 			}
 
@@ -111,6 +128,439 @@ func (s *GenericUploaderTestSuite) TestGenericUpload() {
 	}
 }
 
+func (s *GenericUploaderTestSuite) TestGenericUploadReader() {
+	for _, tt := range s.genericUploadTests {
+		s.Run(tt.name, func() {
+			inputContent, err := ioutil.ReadFile(filepath.Join(testDataFolder, tt.inputFile))
+			if err != nil {
+				s.Failf("Cannot open input golden file", "%s: %v", tt.inputFile, err)
+				return
+			}
+
+			// Unknown size: max size must be enforced while copying
+			uploaded, err := tt.uploader.UploadReader(context.Background(), tt.inputFile, bytes.NewReader(inputContent), -1)
+			if tt.expectedUploadError && err != nil {
+				// No problemo; we anticipated!
+				return
+			} else if err != nil {
+				s.Failf("Cannot upload", "%s: %v", tt.inputFile, err)
+				return
+			}
+
+			defer func() {
+				// Cleanup
+				if err = uploaded.Delete(); err != nil {
+					s.Failf("Cannot delete uploaded file", "%s: %v", uploaded.DiskPath(), err)
+				}
+			}()
+
+			expectedContent, err := ioutil.ReadFile(filepath.Join(testDataFolder, tt.expectedFile))
+			if err != nil {
+				s.Failf("Cannot open output golden file", "%s: %v", tt.expectedFile, err)
+				return
+			}
+
+			// Check if file content valid, read lazily from storage
+			s.Equalf(expectedContent, uploaded.Content(), "upload.Uploaded content invalid")
+			s.Equalf([]string{uploaded.DiskPath()}, s.storage.Keys(), "temporary file left in storage")
+		})
+	}
+}
+
+func (s *GenericUploaderTestSuite) TestNoConverter() {
+	memStorage := storage.NewMemory()
+	u := uploader.NewGeneric(
+		option.Storage(memStorage),
+		option.FileType(utypes.TypePDF),
+		option.ConvertTo(utypes.TypePDF, utypes.TypeMP3),
+	)
+
+	content, err := ioutil.ReadFile(filepath.Join(testDataFolder, "normal.pdf"))
+	s.Require().NoError(err)
+
+	_, err = u.Upload("normal.pdf", content)
+	s.True(errors.Is(err, upload.ErrNoConverter))
+
+	_, err = u.UploadReader(context.Background(), "normal.pdf", bytes.NewReader(content), -1)
+	s.True(errors.Is(err, upload.ErrNoConverter))
+
+	// Nothing renamed to .mp3 nor written
+	s.Empty(memStorage.Keys())
+	s.Equal(0, memStorage.Writes())
+}
+
+func (s *GenericUploaderTestSuite) TestEvents() {
+	var events []upload.Event
+	bus := event.NewBus(option.DispatchSync)
+	bus.OnUploaded(func(e upload.Event) { events = append(events, e) })
+	bus.OnDeleted(func(e upload.Event) { events = append(events, e) })
+
+	u := uploader.NewGeneric(
+		option.Storage(storage.NewMemory()),
+		option.FileType(utypes.TypePDF),
+		option.Events(bus),
+	)
+
+	content, err := ioutil.ReadFile(filepath.Join(testDataFolder, "normal.pdf"))
+	s.Require().NoError(err)
+
+	// Rejected files are not emitted
+	_, err = u.Upload("normal.txt", []byte("text"))
+	s.Require().Error(err)
+	s.Empty(events)
+
+	uploaded, err := u.Upload("normal.pdf", content)
+	s.Require().NoError(err)
+
+	streamed, err := u.UploadReader(context.Background(), "streamed.pdf", bytes.NewReader(content), -1)
+	s.Require().NoError(err)
+
+	s.Require().NoError(uploaded.Delete())
+
+	s.Require().Len(events, 3)
+	s.Equal(upload.EventUploaded, events[0].Type)
+	s.Equal(uploaded, events[0].File)
+	s.Equal(upload.EventUploaded, events[1].Type)
+	s.Equal(streamed, events[1].File)
+	s.Equal(upload.EventDeleted, events[2].Type)
+	s.Equal(uploaded, events[2].File)
+}
+
+func (s *GenericUploaderTestSuite) TestContentAddressedUpload() {
+	memStorage := storage.NewMemory()
+	u := uploader.NewGeneric(
+		option.Storage(memStorage),
+		option.Dir("media"),
+		option.Destination("docs"),
+		option.MediaPrefixURL("/media/"),
+		option.FileType(utypes.TypePDF),
+		option.ContentAddressed(2),
+	)
+
+	content, err := ioutil.ReadFile(filepath.Join(testDataFolder, "normal.pdf"))
+	s.Require().NoError(err)
+
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+
+	first, err := u.Upload("normal.pdf", content)
+	s.Require().NoError(err)
+	s.Equal(filepath.Join("media", "docs", hash[:2], hash[2:4], hash+".pdf"), first.DiskPath())
+	s.Equal("/media/docs/"+hash[:2]+"/"+hash[2:4]+"/"+hash+".pdf", first.URLPath())
+
+	// Same content under another name is not written again
+	second, err := u.Upload("other.PDF", content)
+	s.Require().NoError(err)
+	s.Equal(first.DiskPath(), second.DiskPath())
+	s.Equal(1, memStorage.Writes())
+
+	// Streamed duplicates only leave the original behind
+	third, err := u.UploadReader(context.Background(), "normal.pdf", bytes.NewReader(content), -1)
+	s.Require().NoError(err)
+	s.Equal(first.URLPath(), third.URLPath())
+	s.Equal([]string{first.DiskPath()}, memStorage.Keys())
+
+	// Deleting a duplicate leaves the file of earlier uploads
+	s.Require().NoError(second.Delete())
+	s.Equal([]string{first.DiskPath()}, memStorage.Keys())
+
+	// Converting a duplicate leaves the file of earlier uploads under its former extension
+	convertStorage := storage.NewMemory()
+	opts := []func(upload.Options){
+		option.Storage(convertStorage),
+		option.FileType(utypes.TypePDF),
+		option.ContentAddressed(2),
+	}
+	original, err := uploader.NewGeneric(opts...).Upload("report.dat", content)
+	s.Require().NoError(err)
+
+	converter := uploader.NewGeneric(append(opts, option.ConvertTo(utypes.TypePDF, utypes.TypePDF))...)
+	for i := 0; i < 2; i++ {
+		converted, err := converter.Upload("report.dat", content)
+		s.Require().NoError(err)
+		s.Equal(strings.TrimSuffix(original.DiskPath(), ".dat")+".pdf", converted.DiskPath())
+		s.Equal([]string{original.DiskPath(), converted.DiskPath()}, convertStorage.Keys())
+	}
+}
+
+func (s *GenericUploaderTestSuite) TestPathTemplate() {
+	content, err := ioutil.ReadFile(filepath.Join(testDataFolder, "normal.pdf"))
+	s.Require().NoError(err)
+
+	now := time.Now()
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"default", option.DefaultPathTemplate, fmt.Sprintf(`^docs/%d/%s/my-report_\d{14}\.pdf$`, now.Year(), now.Month())},
+		{"date uuid", "{dest}/{yyyy}/{mm}/{slug}-{uuid}{ext}", fmt.Sprintf(`^docs/%d/%02d/my-report-[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}\.pdf$`, now.Year(), now.Month())},
+		{"ulid", "{ulid}{ext}", `^[0-9A-HJKMNP-TV-Z]{26}\.pdf$`},
+		{"original name", "{dest}/{dd}/{name}{ext}", fmt.Sprintf(`^docs/%02d/My Report\.pdf$`, now.Day())},
+		{"hash", "{hash:0:3}/{hash}_{timestamp}{ext}", `^` + hash[:3] + `/` + hash + `_\d{14}\.pdf$`},
+		{"no escape", "../../{name}{ext}", `^My Report\.pdf$`},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			u := uploader.NewGeneric(
+				option.Storage(storage.NewMemory()),
+				option.Dir("media"),
+				option.Destination("docs"),
+				option.MediaPrefixURL("/media/"),
+				option.FileType(utypes.TypePDF),
+				option.PathTemplate(tt.template),
+			)
+
+			uploaded, err := u.Upload("My Report.PDF", content)
+			s.Require().NoError(err)
+
+			relPath, err := filepath.Rel("media", uploaded.DiskPath())
+			s.Require().NoError(err)
+			s.Regexp(tt.want, relPath)
+
+			// URL and disk layouts agree
+			s.Equal("/media/"+relPath, uploaded.URLPath())
+		})
+	}
+}
+
+func (s *GenericUploaderTestSuite) TestCollision() {
+	content, err := ioutil.ReadFile(filepath.Join(testDataFolder, "normal.pdf"))
+	s.Require().NoError(err)
+
+	root, err := ioutil.TempDir("", "upload")
+	s.Require().NoError(err)
+	defer os.RemoveAll(root)
+
+	tests := []struct {
+		name      string
+		collision int
+		stream    bool
+	}{
+		{"rename", option.CollisionRename, false},
+		{"rename stream", option.CollisionRename, true},
+		{"fail", option.CollisionFail, false},
+		{"fail stream", option.CollisionFail, true},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			u := uploader.NewGeneric(
+				option.Storage(storage.NewLocal()),
+				option.Dir(filepath.Join(root, tt.name)),
+				option.FileType(utypes.TypePDF),
+				option.ConvertTo(utypes.TypePDF, utypes.TypePDF),
+				option.PathTemplate("{slug}{ext}"),
+				option.Collision(tt.collision),
+			)
+
+			const uploads = 50
+
+			type outcome struct {
+				uploaded upload.Uploaded
+				content  []byte
+				err      error
+			}
+
+			var (
+				wg       sync.WaitGroup
+				outcomes = make([]outcome, uploads)
+			)
+
+			// Hammer the same name, each upload with its own content
+			for i := 0; i < uploads; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+
+					fileContent := append(append([]byte(nil), content...), []byte(fmt.Sprintf("%%%d", i))...)
+					uploaded, err := uploadContent(u, tt.stream, "report.pdf", fileContent)
+					outcomes[i] = outcome{uploaded, fileContent, err}
+				}(i)
+			}
+			wg.Wait()
+
+			var (
+				stored = make(map[string][]byte)
+				failed int
+			)
+			for _, o := range outcomes {
+				if errors.Is(o.err, upload.ErrFileExists) {
+					failed++
+					continue
+				}
+				s.Require().NoError(o.err)
+				s.NotContains(stored, o.uploaded.DiskPath(), "two uploads got the same path")
+				s.Equal(".pdf", filepath.Ext(o.uploaded.DiskPath()))
+				stored[o.uploaded.DiskPath()] = o.content
+			}
+
+			if tt.collision == option.CollisionRename {
+				s.Len(stored, uploads)
+			} else {
+				s.Len(stored, 1)
+				s.Equal(uploads-1, failed)
+			}
+
+			s.assertStored(filepath.Join(root, tt.name), stored)
+		})
+	}
+}
+
+func (s *GenericUploaderTestSuite) TestCollisionChangeExt() {
+	content, err := ioutil.ReadFile(filepath.Join(testDataFolder, "normal.pdf"))
+	s.Require().NoError(err)
+
+	root, err := ioutil.TempDir("", "upload")
+	s.Require().NoError(err)
+	defer os.RemoveAll(root)
+
+	tests := []struct {
+		name      string
+		collision int
+		stream    bool
+	}{
+		{"rename", option.CollisionRename, false},
+		{"rename stream", option.CollisionRename, true},
+		{"fail", option.CollisionFail, false},
+		{"fail stream", option.CollisionFail, true},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			// report.dat gets the extension of its type once saved, after report.pdf checked it is free
+			dat := append(append([]byte(nil), content...), "%dat"...)
+			pdf := append(append([]byte(nil), content...), "%pdf"...)
+			ordered := newOrderedStorage(pdf)
+
+			u := uploader.NewGeneric(
+				option.Storage(ordered),
+				option.Dir(filepath.Join(root, tt.name)),
+				option.FileType(utypes.TypePDF),
+				option.ConvertTo(utypes.TypePDF, utypes.TypePDF),
+				option.PathTemplate("{slug}{ext}"),
+				option.Collision(tt.collision),
+			)
+
+			var (
+				wg                   sync.WaitGroup
+				datUpload, pdfUpload upload.Uploaded
+				datErr, pdfErr       error
+			)
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				datUpload, datErr = uploadContent(u, tt.stream, "report.dat", dat)
+			}()
+			go func() {
+				defer wg.Done()
+				pdfUpload, pdfErr = uploadContent(u, tt.stream, "report.pdf", pdf)
+			}()
+			wg.Wait()
+
+			s.Require().NoError(pdfErr)
+			s.Equal(filepath.Join(root, tt.name, "report.pdf"), pdfUpload.DiskPath())
+			stored := map[string][]byte{pdfUpload.DiskPath(): pdf}
+
+			if tt.collision == option.CollisionRename {
+				s.Require().NoError(datErr)
+				s.NotEqual(pdfUpload.DiskPath(), datUpload.DiskPath())
+				s.Equal(".pdf", filepath.Ext(datUpload.DiskPath()))
+				stored[datUpload.DiskPath()] = dat
+			} else {
+				s.True(errors.Is(datErr, upload.ErrFileExists), "error = %v, want %v", datErr, upload.ErrFileExists)
+			}
+
+			s.assertStored(filepath.Join(root, tt.name), stored)
+		})
+	}
+}
+
+// assertStored checks that dir holds exactly the files of stored, none overwritten by another upload
+func (s *GenericUploaderTestSuite) assertStored(dir string, stored map[string][]byte) {
+	for diskPath, fileContent := range stored {
+		got, err := ioutil.ReadFile(diskPath)
+		s.Require().NoError(err)
+		s.Equal(fileContent, got)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	s.Require().NoError(err)
+	s.Len(files, len(stored), "temporary files left behind")
+}
+
+// upload2 uploads content through UploadReader if stream is set, Upload otherwise
+func uploadContent(u *uploader.Generic, stream bool, name string, content []byte) (upload.Uploaded, error) {
+	if stream {
+		return u.UploadReader(context.Background(), name, bytes.NewReader(content), -1)
+	}
+	return u.Upload(name, content)
+}
+
+// orderedStorage orders two uploads racing for a PDF path: the upload of first only creates its
+// PDF once the other one looked at or moved to a PDF path, which waits until first is created.
+type orderedStorage struct {
+	*storage.Local
+	first   []byte
+	looked  chan struct{}
+	created chan struct{}
+	once    sync.Once
+}
+
+func newOrderedStorage(first []byte) *orderedStorage {
+	return &orderedStorage{Local: storage.NewLocal(), first: first, looked: make(chan struct{}), created: make(chan struct{})}
+}
+
+func (s *orderedStorage) Stat(p string) (os.FileInfo, error) {
+	if filepath.Ext(p) == ".pdf" {
+		s.look()
+	}
+	return s.Local.Stat(p)
+}
+
+func (s *orderedStorage) Create(p string, r io.Reader) error {
+	if filepath.Ext(p) != ".pdf" {
+		return s.Local.Create(p, r)
+	}
+
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(content, s.first) {
+		wait(s.looked)
+		defer close(s.created)
+	} else {
+		s.look()
+		wait(s.created)
+	}
+
+	return s.Local.Create(p, bytes.NewReader(content))
+}
+
+func (s *orderedStorage) Rename(oldPath, newPath string) error {
+	if filepath.Ext(newPath) == ".pdf" {
+		s.look()
+		wait(s.created)
+	}
+	return s.Local.Rename(oldPath, newPath)
+}
+
+// look lets the first upload create its PDF
+func (s *orderedStorage) look() {
+	s.once.Do(func() { close(s.looked) })
+}
+
+// wait waits until c is closed, giving up after a while so that a broken order fails rather than hangs
+func wait(c chan struct{}) {
+	select {
+	case <-c:
+	case <-time.After(5 * time.Second):
+	}
+}
+
 func TestGenericUploaderTestSuite(t *testing.T) {
 	suite.Run(t, new(GenericUploaderTestSuite))
 }
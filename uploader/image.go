@@ -1,11 +1,17 @@
 package uploader
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
 
 	"github.com/h2non/filetype"
 	"go.lsl.digital/lardwaz/upload"
 	"go.lsl.digital/lardwaz/upload/file"
+	"go.lsl.digital/lardwaz/upload/metadata"
 	"go.lsl.digital/lardwaz/upload/option"
 	utypes "go.lsl.digital/lardwaz/upload/types"
 )
@@ -24,24 +30,163 @@ func NewImage(opts ...func(upload.Options)) *Image {
 // Upload method to satisfy uploader interface
 func (u *Image) Upload(name string, content []byte) (upload.Uploaded, error) {
 	if !utypes.IsValidImage(content) {
-		return nil, fmt.Errorf("Not a valid image")
+		return nil, upload.ErrInvalidImage
+	}
+
+	fileType, err := filetype.Match(content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error retrieving file type: %v", upload.ErrUnknownType, err)
+	}
+
+	c, newType, err := converterOf(fileType, u.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read before conversion, which does not keep metadata
+	extracted := u.extract(content)
+
+	if c != nil {
+		if err := checkSize(name, int64(len(content)), u.Options); err != nil {
+			return nil, err
+		}
+
+		var converted bytes.Buffer
+		if err := c.Convert(&converted, bytes.NewReader(content)); err != nil {
+			return nil, err
+		}
+		name, content = convertedName(name, newType.Extension), converted.Bytes()
+
+		// Converted images are written upright
+		if extracted != nil {
+			extracted.Orientation = 1
+		}
 	}
 
 	uploadedFile := file.NewGeneric(name, u.Options)
+	uploadedFile.SetMetadata(extracted)
+	if content, err = u.strip(uploadedFile, content); err != nil {
+		return nil, err
+	}
 
 	if err := uploadedFile.Save(content, true); err != nil {
 		return nil, err
 	}
 
-	fileType, err := filetype.MatchFile(uploadedFile.DiskPath())
+	if err := uploadedFile.ChangeExt(newType.Extension); err != nil {
+		// Do not leave the file behind under its former name, unless earlier uploads own it
+		if !uploadedFile.Duplicate() {
+			uploadedFile.Storage().Delete(uploadedFile.DiskPath())
+		}
+		return nil, err
+	}
+
+	emit(u.Options, upload.EventUploaded, uploadedFile)
+
+	return uploadedFile, nil
+}
+
+// UploadReader method to satisfy stream uploader interface
+func (u *Image) UploadReader(ctx context.Context, name string, r io.Reader, size int64) (upload.Uploaded, error) {
+	if err := checkSize(name, size, u.Options); err != nil {
+		return nil, err
+	}
+
+	head, r, err := sniff(&contextReader{ctx: ctx, r: r})
 	if err != nil {
-		return nil, fmt.Errorf("Error retrieving file type: %v", err)
+		return nil, err
+	}
+
+	if !utypes.IsValidImage(head) {
+		return nil, upload.ErrInvalidImage
+	}
+
+	fileType, err := filetype.Match(head)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error retrieving file type: %v", upload.ErrUnknownType, err)
+	}
+
+	c, newType, err := converterOf(fileType, u.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Metadata may follow the pixels, so images are read in memory, before conversion
+	var extracted *upload.Metadata
+	if u.Options.ExtractMetadata() {
+		content, err := ioutil.ReadAll(file.NewMaxSizeReader(r, u.Options.MaxSize()))
+		if err != nil {
+			return nil, err
+		}
+		extracted, r = u.extract(content), bytes.NewReader(content)
+	}
+
+	if c != nil {
+		converted := newConvertReader(c, file.NewMaxSizeReader(r, u.Options.MaxSize()))
+		defer converted.Close()
+		name, r = convertedName(name, newType.Extension), converted
+
+		// Converted images are written upright
+		if extracted != nil {
+			extracted.Orientation = 1
+		}
+	}
+
+	uploadedFile := file.NewGeneric(name, u.Options)
+	uploadedFile.SetMetadata(extracted)
+	if u.Options.StripMetadata() {
+		// Metadata may follow the pixels, so images are stripped in memory
+		content, err := ioutil.ReadAll(file.NewMaxSizeReader(r, u.Options.MaxSize()))
+		if err != nil {
+			return nil, err
+		}
+		if content, err = u.strip(uploadedFile, content); err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(content)
+	}
+
+	if err := uploadedFile.SaveReader(r, true); err != nil {
+		return nil, err
 	}
 
-	newType := u.Options.ConvertTo(fileType)
 	if err := uploadedFile.ChangeExt(newType.Extension); err != nil {
+		// Do not leave the file behind under its former name, unless earlier uploads own it
+		if !uploadedFile.Duplicate() {
+			uploadedFile.Storage().Delete(uploadedFile.DiskPath())
+		}
 		return nil, err
 	}
 
+	emit(u.Options, upload.EventUploaded, uploadedFile)
+
 	return uploadedFile, nil
 }
+
+// extract returns the metadata of content if Options.ExtractMetadata is set
+func (u *Image) extract(content []byte) *upload.Metadata {
+	if !u.Options.ExtractMetadata() {
+		return nil
+	}
+
+	// Images without readable metadata are uploaded all the same
+	m, err := metadata.Extract(content)
+	if err != nil {
+		log.Printf("error extracting image metadata: %v", err)
+	}
+	return m
+}
+
+// strip returns content without metadata if Options.StripMetadata is set, recording what was removed on f
+func (u *Image) strip(f *file.Generic, content []byte) ([]byte, error) {
+	if !u.Options.StripMetadata() {
+		return content, nil
+	}
+
+	content, removed, err := metadata.Strip(content, u.Options.KeepMetadata()...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", upload.ErrInvalidImage, err)
+	}
+	f.SetRemovedMetadata(removed)
+	return content, nil
+}
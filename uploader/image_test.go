@@ -2,7 +2,10 @@ package uploader_test
 
 // Basic imports
 import (
+	"bytes"
+	"context"
 	"flag"
+	"image"
 	"io/ioutil"
 	"path/filepath"
 	"testing"
@@ -10,6 +13,7 @@ import (
 	"github.com/stretchr/testify/suite"
 	"go.lsl.digital/lardwaz/upload"
 	"go.lsl.digital/lardwaz/upload/option"
+	"go.lsl.digital/lardwaz/upload/storage"
 	utypes "go.lsl.digital/lardwaz/upload/types"
 	"go.lsl.digital/lardwaz/upload/uploader"
 )
@@ -32,11 +36,15 @@ type imageUploadTest struct {
 type ImageUploaderTestSuite struct {
 	suite.Suite
 	imageUploadTests []imageUploadTest
+	storage          *storage.Memory
 }
 
 func (s *ImageUploaderTestSuite) SetupSuite() {
+	s.storage = storage.NewMemory()
+
 	// Common upload configurations
 	common := []func(upload.Options){
+		option.Storage(s.storage),
 		option.Dir(testDataFolder),
 		option.Destination("tmp"),
 		option.MediaPrefixURL("/" + testDataFolder + "/"),
@@ -50,6 +58,15 @@ func (s *ImageUploaderTestSuite) SetupSuite() {
 	commonJPEG := append(common, option.ConvertTo(utypes.TypeJPEG, utypes.TypeJPEG))
 	commonPNG := append(common, option.ConvertTo(utypes.TypePNG, utypes.TypePNG))
 	commonMaxSizeOpts := append(common, option.MaxSize(20))
+	commonToJPEG := append(common,
+		option.ConvertTo(utypes.TypePNG, utypes.TypeJPEG),
+		option.ConvertTo(utypes.TypeGIF, utypes.TypeJPEG),
+	)
+	commonToPNG := append(common,
+		option.ConvertTo(utypes.TypeJPEG, utypes.TypePNG),
+		option.ConvertTo(utypes.TypeBMP, utypes.TypePNG),
+		option.ConvertTo(utypes.TypeTIFF, utypes.TypePNG),
+	)
 
 	// Test cases
 	s.imageUploadTests = []imageUploadTest{
@@ -61,6 +78,13 @@ func (s *ImageUploaderTestSuite) SetupSuite() {
 		{"Malformed PNG", "malformed.png", "malformed_out.png", false, false, uploader.NewImage(commonPNG...)},
 		{"Damaged JPG", "damaged.jpg", "damaged_out.jpg", true, false, uploader.NewImage(commonJPEG...)},
 		{"Damaged PNG", "damaged.png", "damaged_out.png", true, false, uploader.NewImage(commonPNG...)},
+		{"PNG to JPG", "normal.png", "normal_convert_out.jpg", false, false, uploader.NewImage(commonToJPEG...)},
+		{"Transparent PNG to JPG", "transparent.png", "transparent_convert_out.jpg", false, false, uploader.NewImage(commonToJPEG...)},
+		{"GIF to JPG", "normal.gif", "normal_gif_convert_out.jpg", false, false, uploader.NewImage(commonToJPEG...)},
+		{"JPG to PNG", "normal.jpg", "normal_convert_out.png", false, false, uploader.NewImage(commonToPNG...)},
+		{"BMP to PNG", "normal.bmp", "normal_bmp_convert_out.png", false, false, uploader.NewImage(commonToPNG...)},
+		{"TIFF to PNG", "normal.tif", "normal_tif_convert_out.png", false, false, uploader.NewImage(commonToPNG...)},
+		{"Damaged PNG to JPG", "damaged.png", "damaged_out.jpg", true, false, uploader.NewImage(commonToJPEG...)},
 	}
 }
 
@@ -89,12 +113,12 @@ func (s *ImageUploaderTestSuite) TestImageUpload() {
 				}
 			}()
 
-			content, err := ioutil.ReadFile(uploaded.DiskPath())
-			if tt.expectedContentError && err != nil {
+			content, ok := s.storage.Bytes(uploaded.DiskPath())
+			if tt.expectedContentError && !ok {
 				// No problemo; we anticipated!
 				return
-			} else if err != nil {
-				s.Failf("Cannot open uploaded file", "%s: %v", uploaded.DiskPath(), err)
+			} else if !ok {
+				s.Failf("Cannot open uploaded file", "%s", uploaded.DiskPath())
 				return
 			}
 
@@ -117,6 +141,146 @@ func (s *ImageUploaderTestSuite) TestImageUpload() {
 	}
 }
 
+func (s *ImageUploaderTestSuite) TestImageUploadReader() {
+	for _, tt := range s.imageUploadTests {
+		s.Run(tt.name, func() {
+			inputContent, err := ioutil.ReadFile(filepath.Join(testDataFolder, tt.inputFile))
+			if err != nil {
+				s.Failf("Cannot open input golden file", "%s: %v", tt.inputFile, err)
+				return
+			}
+
+			// Unknown size: max size must be enforced while copying
+			uploaded, err := tt.uploader.(upload.StreamUploader).UploadReader(context.Background(), tt.inputFile, bytes.NewReader(inputContent), -1)
+			if tt.expectedUploadError && err != nil {
+				// No problemo; we anticipated!
+				return
+			} else if err != nil {
+				s.Failf("Cannot upload", "%s: %v", tt.inputFile, err)
+				return
+			}
+
+			defer func() {
+				// Cleanup
+				if err = uploaded.Delete(); err != nil {
+					s.Failf("Cannot delete uploaded file", "%s: %v", uploaded.DiskPath(), err)
+				}
+			}()
+
+			expectedContent, err := ioutil.ReadFile(filepath.Join(testDataFolder, tt.expectedFile))
+			if err != nil {
+				s.Failf("Cannot open output golden file", "%s: %v", tt.expectedFile, err)
+				return
+			}
+
+			// Check if file content valid, read lazily from storage
+			s.Equalf(expectedContent, uploaded.Content(), "upload.Uploaded content invalid")
+			s.Equalf([]string{uploaded.DiskPath()}, s.storage.Keys(), "temporary file left in storage")
+		})
+	}
+}
+
+func (s *ImageUploaderTestSuite) uploadBoth(name, file string, opts []func(upload.Options), check func(content []byte, uploaded upload.Uploaded)) {
+	content, err := ioutil.ReadFile(filepath.Join(testDataFolder, file))
+	s.Require().NoError(err)
+
+	u := uploader.NewImage(append([]func(upload.Options){
+		option.Storage(storage.NewMemory()),
+		option.FileType(utypes.TypeJPEG),
+		option.FileType(utypes.TypePNG),
+	}, opts...)...)
+
+	uploads := []struct {
+		name   string
+		upload func() (upload.Uploaded, error)
+	}{
+		{"upload", func() (upload.Uploaded, error) {
+			return u.Upload(file, content)
+		}},
+		{"upload_reader", func() (upload.Uploaded, error) {
+			return u.UploadReader(context.Background(), file, bytes.NewReader(content), -1)
+		}},
+	}
+	for _, up := range uploads {
+		s.Run(name+"/"+up.name, func() {
+			uploaded, err := up.upload()
+			s.Require().NoError(err)
+			check(content, uploaded)
+		})
+	}
+}
+
+func (s *ImageUploaderTestSuite) TestStripMetadata() {
+	tests := []struct {
+		name        string
+		file        string
+		opts        []func(upload.Options)
+		wantRemoved int
+		wantSerial  bool // Camera serial number kept in EXIF
+	}{
+		{"keep_by_default", "metadata.jpg", nil, 0, true},
+		{"jpeg", "metadata.jpg", []func(upload.Options){option.StripMetadata()}, 6, false},
+		{"jpeg_whitelist", "metadata.jpg", []func(upload.Options){option.StripMetadata(upload.MetadataEXIF, upload.MetadataICC)}, 4, true},
+		{"png", "metadata.png", []func(upload.Options){option.StripMetadata()}, 5, false},
+	}
+	for _, tt := range tests {
+		s.uploadBoth(tt.name, tt.file, tt.opts, func(content []byte, uploaded upload.Uploaded) {
+			stripped, ok := uploaded.(upload.MetadataStripped)
+			s.Require().True(ok)
+			s.Len(stripped.RemovedMetadata(), tt.wantRemoved)
+
+			saved := uploaded.Content()
+			s.Equal(tt.wantSerial, bytes.Contains(saved, []byte("SN-0123456789")))
+			if tt.wantRemoved == 0 {
+				s.Equal(content, saved)
+			}
+
+			// Still an image of the same size
+			_, _, err := image.Decode(bytes.NewReader(saved))
+			s.NoError(err)
+		})
+	}
+}
+
+func (s *ImageUploaderTestSuite) TestExtractMetadata() {
+	tests := []struct {
+		name            string
+		file            string
+		opts            []func(upload.Options)
+		wantModel       string
+		wantNil         bool
+		wantOrientation int
+	}{
+		{"not_extracted_by_default", "metadata.jpg", nil, "", true, 0},
+		{"jpeg", "metadata.jpg", []func(upload.Options){option.ExtractMetadata()}, "Canon EOS 5D Mark IV", false, 6},
+		{"jpeg_stripped", "metadata.jpg", []func(upload.Options){option.ExtractMetadata(), option.StripMetadata()}, "Canon EOS 5D Mark IV", false, 6},
+		{"png_stripped", "metadata.png", []func(upload.Options){option.ExtractMetadata(), option.StripMetadata()}, "Canon EOS 5D Mark IV", false, 6},
+		{"jpeg_converted", "metadata.jpg", []func(upload.Options){option.ExtractMetadata(), option.ConvertTo(utypes.TypeJPEG, utypes.TypePNG)}, "Canon EOS 5D Mark IV", false, 1},
+		{"orientation_converted", "orientation_6.jpg", []func(upload.Options){option.ExtractMetadata(), option.ConvertTo(utypes.TypeJPEG, utypes.TypePNG)}, "", false, 1},
+		{"without_metadata", "normal.jpg", []func(upload.Options){option.ExtractMetadata()}, "", false, 1},
+	}
+	for _, tt := range tests {
+		s.uploadBoth(tt.name, tt.file, tt.opts, func(content []byte, uploaded upload.Uploaded) {
+			extracted, ok := uploaded.(upload.MetadataExtracted)
+			s.Require().True(ok)
+			if tt.wantNil {
+				s.Nil(extracted.Metadata())
+				return
+			}
+
+			// Read from the content as uploaded, before it is stripped or converted
+			m := extracted.Metadata()
+			s.Require().NotNil(m)
+			s.Equal(tt.wantModel, m.Model)
+			s.Equal(tt.wantOrientation, m.Orientation)
+
+			config, _, err := image.DecodeConfig(bytes.NewReader(content))
+			s.Require().NoError(err)
+			s.Equal(config.Width*config.Height, m.Width*m.Height)
+		})
+	}
+}
+
 func TestImageUploaderTestSuite(t *testing.T) {
 	suite.Run(t, new(ImageUploaderTestSuite))
 }
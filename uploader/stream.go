@@ -0,0 +1,109 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/h2non/filetype/types"
+	"go.lsl.digital/lardwaz/upload"
+	"go.lsl.digital/lardwaz/upload/converter"
+	"go.lsl.digital/lardwaz/upload/option"
+)
+
+// sniffSize is the number of bytes read ahead to detect the file type
+const sniffSize = 8192
+
+// sniff reads the first bytes of r used to detect the file type
+// and returns them along with a reader yielding the whole content
+func sniff(r io.Reader) ([]byte, io.Reader, error) {
+	head := make([]byte, sniffSize)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, nil, err
+	}
+	head = head[:n]
+
+	return head, io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// checkSize verifies a known size against MaxSize before reading anything
+func checkSize(name string, size int64, opts upload.Options) error {
+	if size >= 0 && opts.MaxSize() != option.NoLimit && size > int64(opts.MaxSize()) {
+		log.Printf("file %v greater than max file size: %v\n", name, opts.MaxSize())
+		return upload.ErrMaxSize
+	}
+
+	return nil
+}
+
+// emit sends an event of type t about file to the Events of opts, if any
+func emit(opts upload.Options, t upload.EventType, file upload.Uploaded) {
+	if events := opts.Events(); events != nil {
+		events.Emit(upload.Event{Type: t, File: file})
+	}
+}
+
+// contextReader stops reading once its context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return c.r.Read(p)
+}
+
+// converterOf returns the converter of files of type t to Options.ConvertTo(t)
+// along with the new type, or a nil converter when files keep their type
+func converterOf(t types.Type, opts upload.Options) (upload.Converter, types.Type, error) {
+	newType := opts.ConvertTo(t)
+	if newType.Extension == "" || newType == t {
+		return nil, newType, nil
+	}
+
+	c, err := converter.Get(t, newType)
+	if err != nil {
+		return nil, newType, err
+	}
+
+	return c, newType, nil
+}
+
+// convertedName returns name with the extension ext
+func convertedName(name, ext string) string {
+	return strings.TrimSuffix(name, path.Ext(name)) + "." + ext
+}
+
+// convertReader yields the content of a reader converted by a converter
+type convertReader struct {
+	*io.PipeReader
+	done chan struct{}
+}
+
+func newConvertReader(c upload.Converter, r io.Reader) *convertReader {
+	pr, pw := io.Pipe()
+	cr := &convertReader{PipeReader: pr, done: make(chan struct{})}
+
+	go func() {
+		defer close(cr.done)
+		pw.CloseWithError(c.Convert(pw, r))
+	}()
+
+	return cr
+}
+
+// Close stops the conversion and waits for it to return
+func (c *convertReader) Close() error {
+	err := c.PipeReader.Close()
+	<-c.done
+
+	return err
+}